@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/spf13/cobra"
+)
+
+const (
+	FlagNameRecipient      = "recipient"
+	FlagNameRecipientsFile = "recipients-file"
+	FlagNameIdentity       = "identity"
+	FlagNameArmor          = "armor"
+	FlagNameWorkFactor     = "work-factor"
+
+	// DefaultAgeWorkFactor is the scrypt work factor (log2 of N) of the
+	// reference age implementation.
+	DefaultAgeWorkFactor = 18
+)
+
+// addAgeCommand adds encryption in the age v1 file format
+// (https://age-encryption.org/v1), so files interoperate with the age and
+// rage tools: X25519 recipients ("age1...") or a passphrase (scrypt), an
+// HMAC over the header, and a payload of 64 KiB ChaCha20-Poly1305 chunks,
+// optionally ASCII-armored.
+func addAgeCommand(rootCmd *cobra.Command, o *Options) {
+	var recipients []string
+	var recipientsFilenames []string
+	var identityFilenames []string
+	var useArmor bool
+	var workFactor int
+
+	short := "Encrypt input in the age format"
+	if o.Decode {
+		short = "Decrypt input in the age format"
+	}
+
+	ageCmd := &cobra.Command{
+		Use:   "age",
+		Short: short,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if o.Decode {
+				return ageDecrypt(cmd, o, identityFilenames)
+			}
+			return ageEncrypt(cmd, o, recipients, recipientsFilenames, useArmor, workFactor)
+		},
+	}
+
+	ageCmd.Flags().StringArrayVarP(&recipients, FlagNameRecipient, "r", nil,
+		`recipient public key ("age1..."), for encrypting; may be repeated`)
+	ageCmd.Flags().StringArrayVarP(&recipientsFilenames, FlagNameRecipientsFile, "R", nil,
+		"file of recipient public keys, one per line, for encrypting; may be repeated")
+	ageCmd.Flags().StringArrayVar(&identityFilenames, FlagNameIdentity, nil,
+		`identity file ("AGE-SECRET-KEY-1..." lines), for decrypting; may be repeated`)
+	ageCmd.Flags().BoolVarP(&useArmor, FlagNameArmor, "a", false,
+		"ASCII-armor the encrypted output (detected automatically when decrypting)")
+	ageCmd.Flags().StringVar(&o.PasswordFilename, FlagNamePasswordFile, "",
+		"read the passphrase from this file instead of using recipients or identities")
+	ageCmd.Flags().StringVar(&o.PasswordEnv, FlagNamePasswordEnv, "",
+		"read the passphrase from this environment variable instead of using recipients or identities")
+	ageCmd.Flags().IntVar(&workFactor, FlagNameWorkFactor, DefaultAgeWorkFactor,
+		"scrypt work factor (log2 of N) when encrypting with a passphrase")
+
+	addAgeGenerateCmd(ageCmd)
+	addAgeExtractPublicKeyCmd(ageCmd)
+	rootCmd.AddCommand(ageCmd)
+}
+
+func ageEncrypt(cmd *cobra.Command, o *Options, recipientStrings, recipientsFilenames []string, useArmor bool, workFactor int) error {
+	var recipients []age.Recipient
+	if usePassword(o) {
+		if len(recipientStrings) > 0 || len(recipientsFilenames) > 0 {
+			return fmt.Errorf(`a passphrase cannot be combined with the "--%v" or "--%v" flags`, FlagNameRecipient, FlagNameRecipientsFile)
+		}
+		password, err := readPassword(o)
+		if err != nil {
+			return err
+		}
+		recipient, err := age.NewScryptRecipient(password)
+		if err != nil {
+			return fmt.Errorf("failed to create passphrase recipient: %v", err)
+		}
+		if workFactor < 1 || workFactor > 30 {
+			return fmt.Errorf(`invalid "--%v" value %v: must be in range [1,30]`, FlagNameWorkFactor, workFactor)
+		}
+		recipient.SetWorkFactor(workFactor)
+		recipients = append(recipients, recipient)
+	}
+	for _, s := range recipientStrings {
+		parsed, err := age.ParseRecipients(strings.NewReader(s))
+		if err != nil {
+			return fmt.Errorf("invalid recipient %q: %v", s, err)
+		}
+		recipients = append(recipients, parsed...)
+	}
+	for _, filename := range recipientsFilenames {
+		if isStd(filename) {
+			return fmt.Errorf(`the "--%v" flag does not support "-" (stdin); provide a file path`, FlagNameRecipientsFile)
+		}
+		f, err := os.Open(filename)
+		if err != nil {
+			return fmt.Errorf("failed to open recipients file: %v", err)
+		}
+		parsed, err := age.ParseRecipients(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to parse recipients file %q: %v", filename, err)
+		}
+		recipients = append(recipients, parsed...)
+	}
+	if len(recipients) == 0 {
+		return fmt.Errorf(`missing "--%v", "--%v", "--%v" or "--%v" flag`,
+			FlagNameRecipient, FlagNameRecipientsFile, FlagNamePasswordFile, FlagNamePasswordEnv)
+	}
+
+	out := cmd.OutOrStdout()
+	var armorWriter io.WriteCloser
+	if useArmor {
+		armorWriter = armor.NewWriter(out)
+		out = armorWriter
+	}
+	w, err := age.Encrypt(out, recipients...)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt: %v", err)
+	}
+	if _, err := io.Copy(w, cmd.InOrStdin()); err != nil {
+		return fmt.Errorf("failed to encrypt input: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to finish encryption: %v", err)
+	}
+	if armorWriter != nil {
+		if err := armorWriter.Close(); err != nil {
+			return fmt.Errorf("failed to finish armor: %v", err)
+		}
+	}
+	return nil
+}
+
+func ageDecrypt(cmd *cobra.Command, o *Options, identityFilenames []string) error {
+	var identities []age.Identity
+	if usePassword(o) {
+		if len(identityFilenames) > 0 {
+			return fmt.Errorf(`a passphrase cannot be combined with the "--%v" flag`, FlagNameIdentity)
+		}
+		password, err := readPassword(o)
+		if err != nil {
+			return err
+		}
+		identity, err := age.NewScryptIdentity(password)
+		if err != nil {
+			return fmt.Errorf("failed to create passphrase identity: %v", err)
+		}
+		identities = append(identities, identity)
+	}
+	for _, filename := range identityFilenames {
+		parsed, err := readAgeIdentities(cmd, filename, false)
+		if err != nil {
+			return err
+		}
+		identities = append(identities, parsed...)
+	}
+	if len(identities) == 0 {
+		return fmt.Errorf(`missing "--%v", "--%v" or "--%v" flag`, FlagNameIdentity, FlagNamePasswordFile, FlagNamePasswordEnv)
+	}
+
+	// Armored input is detected by its header line.
+	in := bufio.NewReader(cmd.InOrStdin())
+	var ciphertextReader io.Reader = in
+	if start, _ := in.Peek(len(armor.Header)); string(start) == armor.Header {
+		ciphertextReader = armor.NewReader(in)
+	}
+	r, err := age.Decrypt(ciphertextReader, identities...)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt: %v", err)
+	}
+	if _, err := io.Copy(cmd.OutOrStdout(), r); err != nil {
+		return fmt.Errorf("failed to decrypt input: %v", err)
+	}
+	return nil
+}
+
+func addAgeGenerateCmd(ageCmd *cobra.Command) {
+	var privateFilename string
+	var publicFilename string
+
+	generateCmd := &cobra.Command{
+		Use:     "generate",
+		Aliases: []string{"gen"},
+		Short:   "Generate a new age X25519 identity",
+		Args:    cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			identity, err := age.GenerateX25519Identity()
+			if err != nil {
+				return fmt.Errorf("failed to generate age identity: %v", err)
+			}
+
+			privateWriter := fileWriter(ageCmd, FilenameDescriptionPrivateKey, privateFilename, true, 0400)
+			publicWriter := fileWriter(ageCmd, FilenameDescriptionPublicKey, publicFilename, true, 0444)
+
+			// The same layout as age-keygen, which age reads back as is.
+			if _, err := fmt.Fprintf(privateWriter, "# created: %v\n# public key: %v\n%v\n",
+				time.Now().UTC().Format(time.RFC3339), identity.Recipient(), identity); err != nil {
+				return fmt.Errorf("failed to write private key: %v", err)
+			}
+			if _, err := fmt.Fprintln(publicWriter, identity.Recipient()); err != nil {
+				return fmt.Errorf("failed to write public key: %v", err)
+			}
+			return nil
+		},
+	}
+
+	generateCmd.Flags().StringVar(&privateFilename, FlagNamePrivateKey, "-",
+		"file from which to read or write the private key")
+
+	generateCmd.Flags().StringVar(&publicFilename, FlagNamePublicKey, "-",
+		"file from which to read or write the public key")
+
+	ageCmd.AddCommand(generateCmd)
+}
+
+func addAgeExtractPublicKeyCmd(ageCmd *cobra.Command) {
+	var privateFilename string
+	var publicFilename string
+
+	extractPublicKeyCmd := &cobra.Command{
+		Use:     "extract",
+		Aliases: []string{"extract-public-key", "extract-public", "epk", "ep", "e"},
+		Short:   "Extract the recipients of the identities in a given identity file",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			identities, err := readAgeIdentities(cmd, privateFilename, true)
+			if err != nil {
+				return err
+			}
+			publicWriter := fileWriter(ageCmd, FilenameDescriptionPublicKey, publicFilename, true, 0444)
+			for _, identity := range identities {
+				var recipient fmt.Stringer
+				switch identity := identity.(type) {
+				case *age.X25519Identity:
+					recipient = identity.Recipient()
+				case *age.HybridIdentity:
+					recipient = identity.Recipient()
+				default:
+					return fmt.Errorf("unsupported identity type %T", identity)
+				}
+				if _, err := fmt.Fprintln(publicWriter, recipient); err != nil {
+					return fmt.Errorf("failed to write public key: %v", err)
+				}
+			}
+			return nil
+		},
+	}
+
+	extractPublicKeyCmd.Flags().StringVar(&privateFilename, FlagNamePrivateKey, "-",
+		"file from which to read or write the private key")
+
+	extractPublicKeyCmd.Flags().StringVar(&publicFilename, FlagNamePublicKey, "-",
+		"file from which to read or write the public key")
+
+	ageCmd.AddCommand(extractPublicKeyCmd)
+}
+
+func readAgeIdentities(cmd *cobra.Command, filename string, canUseStdin bool) ([]age.Identity, error) {
+	reader := fileReader(cmd, FilenameDescriptionPrivateKey, filename, canUseStdin)
+	if reader == nil {
+		return nil, fmt.Errorf(`the "--%v" flag does not support "-" (stdin); provide a file path`, FlagNameIdentity)
+	}
+	identities, err := age.ParseIdentities(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse identity file %q: %v", filename, err)
+	}
+	return identities, nil
+}
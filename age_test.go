@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+func generateAgeIdentity(t *testing.T, dir, prefix string) (identityFilename, recipient string) {
+	t.Helper()
+	identityFilename = path.Join(dir, prefix+"identity.txt")
+	publicKeyFilename := path.Join(dir, prefix+"recipient.txt")
+	if _, _, err := runRSACmd(t,
+		[]string{"age", "generate", "--private-key", identityFilename, "--public-key", publicKeyFilename}, ""); err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+	bs, err := os.ReadFile(publicKeyFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return identityFilename, strings.TrimSpace(string(bs))
+}
+
+func TestAgeX25519EndToEnd(t *testing.T) {
+	tempDir := t.TempDir()
+	identityFilename, recipient := generateAgeIdentity(t, tempDir, "")
+	otherIdentityFilename, _ := generateAgeIdentity(t, tempDir, "other-")
+
+	// Several 64 KiB payload chunks.
+	plaintext := strings.Repeat("This is a test of age encryption.\n", 8192)
+	for _, armored := range []bool{false, true} {
+		args := []string{"age", "--recipient", recipient}
+		wantPrefix := "age-encryption.org/v1\n-> X25519 "
+		if armored {
+			args = append(args, "--armor")
+			wantPrefix = armor.Header
+		}
+		ciphertext, _, err := runRSACmd(t, args, plaintext)
+		if err != nil {
+			t.Fatalf("armor=%v: unexpected encryption error: %v", armored, err)
+		}
+		if !strings.HasPrefix(ciphertext, wantPrefix) {
+			t.Fatalf("armor=%v: wanted a ciphertext starting with %q, got %q", armored, wantPrefix, ciphertext[:64])
+		}
+
+		decrypted, _, err := runRSACmd(t, []string{"age", "--decrypt", "--identity", identityFilename}, ciphertext)
+		if err != nil {
+			t.Fatalf("armor=%v: unexpected decryption error: %v", armored, err)
+		}
+		if decrypted != plaintext {
+			t.Fatalf("armor=%v: roundtrip failed: got %v bytes, wanted %v", armored, len(decrypted), len(plaintext))
+		}
+
+		_, _, err = runRSACmd(t, []string{"age", "--decrypt", "--identity", otherIdentityFilename}, ciphertext)
+		if err == nil || !strings.Contains(err.Error(), "identity did not match any of the recipients") {
+			t.Fatalf("armor=%v: expected a no identity error, got %v", armored, err)
+		}
+	}
+}
+
+// Files must interoperate with the reference implementation in both
+// directions.
+func TestAgeInteroperability(t *testing.T) {
+	tempDir := t.TempDir()
+	identityFilename, recipientString := generateAgeIdentity(t, tempDir, "")
+	f, err := os.Open(identityFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	identities, err := age.ParseIdentities(f)
+	if err != nil {
+		t.Fatalf("generated identity file doesn't parse: %v", err)
+	}
+	recipient, err := age.ParseX25519Recipient(recipientString)
+	if err != nil {
+		t.Fatalf("generated recipient doesn't parse: %v", err)
+	}
+	plaintext := "Hello, age! 🔐"
+
+	ciphertext, _, err := runRSACmd(t, []string{"age", "-r", recipientString}, plaintext)
+	if err != nil {
+		t.Fatalf("unexpected encryption error: %v", err)
+	}
+	r, err := age.Decrypt(strings.NewReader(ciphertext), identities...)
+	if err != nil {
+		t.Fatalf("reference decryption failed: %v", err)
+	}
+	decrypted, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("reference decryption failed: %v", err)
+	}
+	if string(decrypted) != plaintext {
+		t.Fatalf("wanted %q, got %q", plaintext, decrypted)
+	}
+
+	var buf bytes.Buffer
+	w, err := age.Encrypt(&buf, recipient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, plaintext)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	decryptedString, _, err := runRSACmd(t, []string{"age", "--decrypt", "--identity", identityFilename}, buf.String())
+	if err != nil {
+		t.Fatalf("unexpected decryption error: %v", err)
+	}
+	if decryptedString != plaintext {
+		t.Fatalf("wanted %q, got %q", plaintext, decryptedString)
+	}
+}
+
+func TestAgeMultipleRecipients(t *testing.T) {
+	tempDir := t.TempDir()
+	oneIdentityFilename, oneRecipient := generateAgeIdentity(t, tempDir, "one-")
+	twoIdentityFilename, twoRecipient := generateAgeIdentity(t, tempDir, "two-")
+	recipientsFilename := path.Join(tempDir, "recipients.txt")
+	mustWrite(t, recipientsFilename, []byte("# on call\n"+twoRecipient+"\n"))
+
+	plaintext := "Hello, recipients! 🔐"
+	ciphertext, _, err := runRSACmd(t, []string{"age", "-r", oneRecipient, "-R", recipientsFilename}, plaintext)
+	if err != nil {
+		t.Fatalf("unexpected encryption error: %v", err)
+	}
+	for _, identityFilename := range []string{oneIdentityFilename, twoIdentityFilename} {
+		decrypted, _, err := runRSACmd(t, []string{"age", "--decrypt", "--identity", identityFilename}, ciphertext)
+		if err != nil {
+			t.Fatalf("unexpected decryption error: %v", err)
+		}
+		if decrypted != plaintext {
+			t.Fatalf("wanted %q, got %q", plaintext, decrypted)
+		}
+	}
+}
+
+func TestAgePassphrase(t *testing.T) {
+	t.Setenv("ENC_TEST_PASSWORD", "hunter2")
+	t.Setenv("ENC_TEST_WRONG_PASSWORD", "hunter3")
+	plaintext := "Hello, age passphrase! 🔐"
+
+	ciphertext, _, err := runRSACmd(t,
+		[]string{"age", "--password-env", "ENC_TEST_PASSWORD", "--work-factor", "10"}, plaintext)
+	if err != nil {
+		t.Fatalf("unexpected encryption error: %v", err)
+	}
+	if !strings.HasPrefix(ciphertext, "age-encryption.org/v1\n-> scrypt ") {
+		t.Fatalf("wanted a scrypt stanza, got %q", ciphertext[:64])
+	}
+	decrypted, _, err := runRSACmd(t, []string{"age", "--decrypt", "--password-env", "ENC_TEST_PASSWORD"}, ciphertext)
+	if err != nil {
+		t.Fatalf("unexpected decryption error: %v", err)
+	}
+	if decrypted != plaintext {
+		t.Fatalf("wanted %q, got %q", plaintext, decrypted)
+	}
+	if _, _, err := runRSACmd(t, []string{"age", "--decrypt", "--password-env", "ENC_TEST_WRONG_PASSWORD"}, ciphertext); err == nil {
+		t.Fatal("expected an error decrypting with the wrong passphrase, got nil")
+	}
+}
+
+func TestAgeExtract(t *testing.T) {
+	tempDir := t.TempDir()
+	identityFilename, recipient := generateAgeIdentity(t, tempDir, "")
+	identity, err := os.ReadFile(identityFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	extracted, _, err := runRSACmd(t, []string{"age", "extract"}, string(identity))
+	if err != nil {
+		t.Fatalf("extract failed: %v", err)
+	}
+	if extracted != recipient+"\n" {
+		t.Fatalf("wanted %q, got %q", recipient+"\n", extracted)
+	}
+}
+
+func TestAgeErrors(t *testing.T) {
+	t.Setenv("ENC_TEST_PASSWORD", "hunter2")
+	tempDir := t.TempDir()
+	identityFilename, recipient := generateAgeIdentity(t, tempDir, "")
+
+	for _, tc := range []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"age"}, `missing "--recipient", "--recipients-file", "--password-file" or "--password-env" flag`},
+		{[]string{"age", "--decrypt"}, `missing "--identity", "--password-file" or "--password-env" flag`},
+		{[]string{"age", "-r", "age1invalid"}, `invalid recipient "age1invalid"`},
+		{[]string{"age", "-r", recipient, "--password-env", "ENC_TEST_PASSWORD"},
+			`a passphrase cannot be combined with the "--recipient" or "--recipients-file" flags`},
+		{[]string{"age", "--decrypt", "--identity", identityFilename, "--password-env", "ENC_TEST_PASSWORD"},
+			`a passphrase cannot be combined with the "--identity" flag`},
+		{[]string{"age", "--password-env", "ENC_TEST_PASSWORD", "--work-factor", "0"},
+			`invalid "--work-factor" value 0: must be in range [1,30]`},
+		{[]string{"age", "-R", "-"}, `the "--recipients-file" flag does not support "-"`},
+	} {
+		_, _, err := runRSACmd(t, tc.args, "")
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Fatalf("args=%#v: expected error containing %q, got %v", tc.args, tc.err, err)
+		}
+	}
+}
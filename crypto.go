@@ -1,15 +1,18 @@
 package main
 
 import (
+	"bufio"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/des"
 	"crypto/rand"
+	"enc/padding"
 	"encoding/hex"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
 )
@@ -27,12 +30,13 @@ func addSymmetricCryptoCommands(rootCmd *cobra.Command, o *Options) {
 		cipherFunc  func([]byte) (cipher.Block, error)
 		aliases     []string
 		defaultMode cryptoMode
+		keySize     int // Key size derived from a password.
 	}
 
 	for _, cmdInfo := range []cryptoSymCmdInfo{
-		{"aes", CipherNameAES, aes.NewCipher, nil, cryptoModeGCM},
-		{"des", CipherNameDES, des.NewCipher, nil, cryptoModeCTR},
-		{"des3", CipherNameTRIPLEDES, des.NewTripleDESCipher, []string{"3des", "tripledes", "triple-des"}, cryptoModeCTR},
+		{"aes", CipherNameAES, aes.NewCipher, nil, cryptoModeGCM, 32},
+		{"des", CipherNameDES, des.NewCipher, nil, cryptoModeCTR, 8},
+		{"des3", CipherNameTRIPLEDES, des.NewTripleDESCipher, []string{"3des", "tripledes", "triple-des"}, cryptoModeCTR, 24},
 	} {
 		short := "Encrypt input using " + cmdInfo.cipherName
 		if o.Decode {
@@ -48,12 +52,31 @@ func addSymmetricCryptoCommands(rootCmd *cobra.Command, o *Options) {
 			Aliases: cmdInfo.aliases,
 			PreRun: func(cmd *cobra.Command, args []string) {
 				o.CryptoMode = activeCryptoMode
+				applyOpenSSLDefaults(cmd, o)
 			},
 			RunE: func(cmd *cobra.Command, _ []string) error {
+				// "--key-size" only picks the size of a password-derived
+				// key; a raw key's own length picks the AES variant.
+				keySize := cmdInfo.keySize
+				if cmdInfo.cmdName == "aes" && (o.OpenSSL || usePassword(o)) {
+					var err error
+					if keySize, err = aesKeySize(o.KeySizeBits); err != nil {
+						return err
+					}
+				} else if cmd.Flags().Changed(FlagNameKeySize) {
+					log.Printf("WARNING: ignoring irrelevant %q flag without a password: the key file's length sets the key size",
+						"--"+FlagNameKeySize)
+				}
+				if o.OpenSSL {
+					if o.Decode {
+						return decryptOpenSSL(cmd, o, cmdInfo.cipherName, cmdInfo.cipherFunc, keySize)
+					}
+					return encryptOpenSSL(cmd, o, cmdInfo.cipherName, cmdInfo.cipherFunc, keySize)
+				}
 				if o.Decode {
-					return decrypt(cmd, o, cmdInfo.cipherName, cmdInfo.cipherFunc)
+					return decrypt(cmd, o, cmdInfo.cipherName, cmdInfo.cipherFunc, keySize)
 				}
-				return encrypt(cmd, o, cmdInfo.cipherName, cmdInfo.cipherFunc)
+				return encrypt(cmd, o, cmdInfo.cipherName, cmdInfo.cipherFunc, keySize)
 			},
 		}
 
@@ -64,43 +87,125 @@ func addSymmetricCryptoCommands(rootCmd *cobra.Command, o *Options) {
 			o.InitializationVectorFilename, "initialization vector filename")
 		cryptoCmd.Flags().BoolVarP(&o.OmitInitializationVector, FlagNameOmitIV, "",
 			o.OmitInitializationVector, "omit the initialization vector from encrypted output")
+		cryptoCmd.Flags().Var(&o.Padding, FlagNamePadding,
+			fmt.Sprintf("padding for %q mode: %v (default %q)", cryptoModeECB, paddingSchemesString, paddingSchemePKCS7))
+		cryptoCmd.Flags().StringVar(&o.PasswordFilename, FlagNamePasswordFile, "",
+			fmt.Sprintf("derive a %v-byte key from the password in this file instead of using --%v", cmdInfo.keySize, FlagNameKey))
+		cryptoCmd.Flags().StringVar(&o.PasswordEnv, FlagNamePasswordEnv, "",
+			fmt.Sprintf("derive a %v-byte key from the password in this environment variable instead of using --%v", cmdInfo.keySize, FlagNameKey))
+		cryptoCmd.Flags().IntVar(&o.Iterations, FlagNameIterations, DefaultPBKDF2Iterations,
+			"PBKDF2 iteration count when encrypting with a password; read from the ciphertext when decrypting")
 
 		if cmdInfo.cmdName == "aes" {
 			cryptoCmd.Flags().StringVarP(&o.AdditionalDataFilename, "additional-data", "a", "",
-				fmt.Sprintf("additional data filename for %q mode", cryptoModeGCM))
+				fmt.Sprintf("additional data filename for %q, %q, %q and %q modes", cryptoModeGCM, cryptoModeGCMStream, cryptoModeGCMSIV, cryptoModeSIV))
+			cryptoCmd.Flags().StringVar(&o.TagFilename, FlagNameTagFile, "",
+				fmt.Sprintf("in %q mode, write the authentication tag to this file instead of appending it to the ciphertext (read it back when decrypting)", cryptoModeGCM))
+			cryptoCmd.Flags().IntVar(&o.KeySizeBits, FlagNameKeySize, 256,
+				"key size in bits when deriving the key from a password: 128, 192, 256 (ignored with --key, whose length decides)")
+			cryptoCmd.Flags().BoolVar(&o.OpenSSL, FlagNameOpenSSL, false,
+				fmt.Sprintf(`use the "openssl enc" format ("Salted__" header, key and IV derived from the password) in %q (default) or %q mode`,
+					cryptoModeCBC, cryptoModeCTR))
+			cryptoCmd.Flags().StringVar(&o.OpenSSLKDF, FlagNameOpenSSLKDF, "pbkdf2",
+				fmt.Sprintf(`key derivation for --%v: %v ("pbkdf2" is "-pbkdf2", default --%v %v; "md5"/"sha256" are the legacy "-md md5"/"-md sha256")`,
+					FlagNameOpenSSL, strings.Join(opensslKDFNames, ", "), FlagNameIterations, DefaultOpenSSLIterations))
 		}
 
+		cryptoCmd.Flags().BoolVar(&o.Envelope, FlagNameEnvelope, false,
+			"prepend a header describing the cipher, mode and parameters, read back automatically when decrypting")
+
+		addInspectCmd(cryptoCmd)
+		addSymmetricGenerateCmd(cryptoCmd, cmdInfo.cipherName, cmdInfo.keySize)
 		rootCmd.AddCommand(cryptoCmd)
 	}
 }
 
 // Encryption.
-func encrypt(cmd *cobra.Command, o *Options, cipherName string, cipherFunc func([]byte) (cipher.Block, error)) error {
+func encrypt(cmd *cobra.Command, o *Options, cipherName string, cipherFunc func([]byte) (cipher.Block, error), keySize int) error {
 	// Determine the encryption mode.
 	var encryptFunc func(string, cipher.Block, []byte, io.Writer, *Options) error
+	var streamEncryptFunc func(string, cipher.Block, io.Reader, io.Writer, *Options) error
 	switch o.CryptoMode {
 	case cryptoModeBlock:
 		encryptFunc = encryptBlock
+	case cryptoModeCBC:
+		encryptFunc = encryptCBC
+	case cryptoModeCFB:
+		encryptFunc = encryptCFB
 	case cryptoModeCTR:
 		encryptFunc = encryptCTR
+	case cryptoModeECB:
+		encryptFunc = encryptECB
+	case cryptoModeOFB:
+		encryptFunc = encryptOFB
 	case cryptoModeGCM:
 		encryptFunc = encryptGCMAEAD
+	case cryptoModeGCMStream:
+		streamEncryptFunc = encryptGCMStream
+	case cryptoModeGCMSIV:
+		encryptFunc = encryptGCMSIV
+	case cryptoModeSIV:
+		encryptFunc = encryptSIV
 	default:
 		return fmt.Errorf("mode %q not implemented", o.CryptoMode)
 	}
+	if o.Padding != "" && o.CryptoMode != cryptoModeECB {
+		return fmt.Errorf(`the "--%v" flag is only supported in %q mode`, FlagNamePadding, cryptoModeECB)
+	}
+	if o.TagFilename != "" && o.CryptoMode != cryptoModeGCM {
+		return fmt.Errorf(`the "--%v" flag is only supported in %q mode`, FlagNameTagFile, cryptoModeGCM)
+	}
+	if err := checkAESOnlyMode(cipherName, o); err != nil {
+		return err
+	}
+	if o.CryptoMode == cryptoModeSIV {
+		// SIV keys are two cipher keys back to back.
+		keySize *= 2
+	}
 
-	// Read the encryption key.
-	key, err := readKeyFile(o.KeyFilename)
+	// Read the encryption key, or derive it from a password.
+	var key, passwordHeader []byte
+	var err error
+	if usePassword(o) {
+		key, passwordHeader, err = derivePasswordEncryptionKey(o, keySize)
+	} else {
+		key, err = readKeyFile(o.KeyFilename)
+	}
 	if err != nil {
 		return err
 	}
 	o.KeyBytes = key
 
-	// Generate the cipher.
-	c, err := cipherFunc(key)
+	// Generate the cipher. In SIV mode it is keyed with the first half of the
+	// key, and the mode keys a second cipher with the other half.
+	cipherKey := key
+	if o.CryptoMode == cryptoModeSIV {
+		if cipherKey, err = sivCipherKey(key); err != nil {
+			return err
+		}
+	}
+	c, err := cipherFunc(cipherKey)
 	if err != nil {
 		return fmt.Errorf("failed to create %v cipher: %v", cipherName, err)
 	}
+	if cipherName == CipherNameTRIPLEDES {
+		warnDegenerateTripleDESKey(cipherKey)
+	}
+
+	// The envelope and password headers precede the mode's own output.
+	var envelope []byte
+	if o.Envelope {
+		if envelope, err = newEnvelope(cipherName, c, len(key), o); err != nil {
+			return err
+		}
+		o.EnvelopeBytes = envelope
+	}
+	ciphertextWriter := &prefixWriter{cmd.OutOrStdout(), append(envelope, passwordHeader...)}
+
+	// Streaming modes read the plaintext incrementally, in constant memory.
+	if streamEncryptFunc != nil {
+		return streamEncryptFunc(cipherName, c, cmd.InOrStdin(), ciphertextWriter, o)
+	}
 
 	// Read the plaintext.
 	plaintextReader := cmd.InOrStdin()
@@ -110,40 +215,103 @@ func encrypt(cmd *cobra.Command, o *Options, cipherName string, cipherFunc func(
 	}
 
 	// Encrypt and write the output.
-	ciphertextWriter := cmd.OutOrStdout()
 	return encryptFunc(cipherName, c, plaintext, ciphertextWriter, o)
 }
 
 // Decryption.
-func decrypt(cmd *cobra.Command, o *Options, cipherName string, cipherFunc func([]byte) (cipher.Block, error)) error {
+func decrypt(cmd *cobra.Command, o *Options, cipherName string, cipherFunc func([]byte) (cipher.Block, error), keySize int) error {
+	// An envelope, if present, selects the mode.
+	ciphertextReader := bufio.NewReader(cmd.InOrStdin())
+	envelope, envelopeBytes, err := readEnvelope(ciphertextReader)
+	if err != nil {
+		return err
+	}
+	if envelope != nil {
+		o.EnvelopeBytes = envelopeBytes
+		if err := applyEnvelope(cmd, envelope, cipherName, o); err != nil {
+			return err
+		}
+	}
+
 	// Determine the encryption mode.
 	var decryptFunc func(string, cipher.Block, []byte, io.Writer, *Options) error
+	var streamDecryptFunc func(string, cipher.Block, io.Reader, io.Writer, *Options) error
 	switch o.CryptoMode {
 	case cryptoModeBlock:
 		decryptFunc = decryptBlock
+	case cryptoModeCBC:
+		decryptFunc = decryptCBC
+	case cryptoModeCFB:
+		decryptFunc = decryptCFB
 	case cryptoModeCTR:
 		decryptFunc = decryptCTR
+	case cryptoModeECB:
+		decryptFunc = decryptECB
+	case cryptoModeOFB:
+		decryptFunc = decryptOFB
 	case cryptoModeGCM:
 		decryptFunc = decryptGCMAEAD
+	case cryptoModeGCMStream:
+		streamDecryptFunc = decryptGCMStream
+	case cryptoModeGCMSIV:
+		decryptFunc = decryptGCMSIV
+	case cryptoModeSIV:
+		decryptFunc = decryptSIV
 	default:
 		return fmt.Errorf("mode %q not implemented", o.CryptoMode)
 	}
+	if o.Padding != "" && o.CryptoMode != cryptoModeECB {
+		return fmt.Errorf(`the "--%v" flag is only supported in %q mode`, FlagNamePadding, cryptoModeECB)
+	}
+	if o.TagFilename != "" && o.CryptoMode != cryptoModeGCM {
+		return fmt.Errorf(`the "--%v" flag is only supported in %q mode`, FlagNameTagFile, cryptoModeGCM)
+	}
+	if err := checkAESOnlyMode(cipherName, o); err != nil {
+		return err
+	}
+	if o.CryptoMode == cryptoModeSIV {
+		// SIV keys are two cipher keys back to back.
+		keySize *= 2
+	}
 
-	// Read the decryption key.
-	key, err := readKeyFile(o.KeyFilename)
+	// Read the decryption key, or derive it from a password and the header
+	// in front of the ciphertext.
+	var key []byte
+	if usePassword(o) {
+		key, err = derivePasswordDecryptionKey(ciphertextReader, o, keySize)
+	} else {
+		key, err = readKeyFile(o.KeyFilename)
+	}
 	if err != nil {
 		return err
 	}
+	if envelope != nil && len(key) != envelope.KeySize {
+		return fmt.Errorf("key size %v bytes does not match the envelope's %v bytes", len(key), envelope.KeySize)
+	}
 	o.KeyBytes = key
 
-	// Generate the cipher.
-	c, err := cipherFunc(key)
+	// Generate the cipher. In SIV mode it is keyed with the first half of the
+	// key, and the mode keys a second cipher with the other half.
+	cipherKey := key
+	if o.CryptoMode == cryptoModeSIV {
+		if cipherKey, err = sivCipherKey(key); err != nil {
+			return err
+		}
+	}
+	c, err := cipherFunc(cipherKey)
 	if err != nil {
 		return fmt.Errorf("failed to create %v cipher: %v", cipherName, err)
 	}
+	if cipherName == CipherNameTRIPLEDES {
+		warnDegenerateTripleDESKey(cipherKey)
+	}
+
+	// Streaming modes read the ciphertext incrementally, in constant memory.
+	if streamDecryptFunc != nil {
+		return streamDecryptFunc(cipherName, c, ciphertextReader, cmd.OutOrStdout(), o)
+	}
 
 	// Read the ciphertext.
-	ciphertextReader := cmd.InOrStdin()
 	ciphertext, err := io.ReadAll(ciphertextReader)
 	if err != nil {
 		return fmt.Errorf("failed to read plaintext: %v", err)
@@ -170,10 +338,10 @@ func readKeyFile(filename string) ([]byte, error) {
 	return key, nil
 }
 
-// Block mode encryption.
+// Block mode encryption of exactly one block.
 func encryptBlock(cipherName string, c cipher.Block, plaintext []byte, ciphertextWriter io.Writer, o *Options) error {
-	if len(o.KeyBytes) != len(plaintext) {
-		return fmt.Errorf("%v/encrypt: key size %vb != input size %vb", cipherName, len(o.KeyBytes), len(plaintext))
+	if len(plaintext) != c.BlockSize() {
+		return fmt.Errorf("%v/encrypt: input size %vb != block size %vb", cipherName, len(plaintext), c.BlockSize())
 	}
 	c.Encrypt(plaintext, plaintext)
 	if _, err := ciphertextWriter.Write(plaintext); err != nil {
@@ -182,10 +350,10 @@ func encryptBlock(cipherName string, c cipher.Block, plaintext []byte, ciphertex
 	return nil
 }
 
-// Block mode decryption.
+// Block mode decryption of exactly one block.
 func decryptBlock(cipherName string, c cipher.Block, ciphertext []byte, plaintextWriter io.Writer, o *Options) error {
-	if len(o.KeyBytes) != len(ciphertext) {
-		return fmt.Errorf("%v/decrypt: key size %vb != message size %vb", cipherName, len(o.KeyBytes), len(ciphertext))
+	if len(ciphertext) != c.BlockSize() {
+		return fmt.Errorf("%v/decrypt: message size %vb != block size %vb", cipherName, len(ciphertext), c.BlockSize())
 	}
 	c.Decrypt(ciphertext, ciphertext)
 	if _, err := plaintextWriter.Write(ciphertext); err != nil {
@@ -194,27 +362,212 @@ func decryptBlock(cipherName string, c cipher.Block, ciphertext []byte, plaintex
 	return nil
 }
 
+// ECB mode encryption, with selectable padding.
+func encryptECB(cipherName string, c cipher.Block, plaintext []byte, ciphertextWriter io.Writer, o *Options) error {
+	if err := rejectIVFlagsForECB(o); err != nil {
+		return err
+	}
+	log.Printf("WARNING: %q mode encrypts identical plaintext blocks to identical ciphertext blocks, "+
+		"leaking patterns in the input; use it only for test vectors and legacy interop", cryptoModeECB)
+
+	blockSize := c.BlockSize()
+	var padded []byte
+	var err error
+	switch o.Padding {
+	case "", paddingSchemePKCS7:
+		padded, err = padding.PadPKCS7(plaintext, uint8(blockSize))
+	case paddingSchemeZero:
+		padded, err = padding.PadZero(plaintext, uint8(blockSize))
+	case paddingSchemeNone:
+		padded = plaintext
+	}
+	if err != nil {
+		return fmt.Errorf("failed to pad plaintext: %v", err)
+	}
+	if len(padded)%blockSize != 0 {
+		return fmt.Errorf("%v/encrypt: input size %vb is not a multiple of block size %vb (use --%v=%v or --%v=%v)",
+			cipherName, len(padded), blockSize, FlagNamePadding, paddingSchemePKCS7, FlagNamePadding, paddingSchemeZero)
+	}
+
+	ciphertext := make([]byte, len(padded))
+	for i := 0; i < len(padded); i += blockSize {
+		c.Encrypt(ciphertext[i:i+blockSize], padded[i:i+blockSize])
+	}
+	if _, err := ciphertextWriter.Write(ciphertext); err != nil {
+		return fmt.Errorf("failed to write ciphertext: %v", err)
+	}
+	return nil
+}
+
+// ECB mode decryption, with selectable padding.
+func decryptECB(cipherName string, c cipher.Block, ciphertext []byte, plaintextWriter io.Writer, o *Options) error {
+	if err := rejectIVFlagsForECB(o); err != nil {
+		return err
+	}
+
+	blockSize := c.BlockSize()
+	if len(ciphertext)%blockSize != 0 {
+		return fmt.Errorf("%v/decrypt: ciphertext size %vb is not a multiple of block size %vb",
+			cipherName, len(ciphertext), blockSize)
+	}
+	padded := make([]byte, len(ciphertext))
+	for i := 0; i < len(ciphertext); i += blockSize {
+		c.Decrypt(padded[i:i+blockSize], ciphertext[i:i+blockSize])
+	}
+
+	var plaintext []byte
+	var err error
+	switch o.Padding {
+	case "", paddingSchemePKCS7:
+		plaintext, err = padding.UnpadPKCS7(padded)
+	case paddingSchemeZero:
+		plaintext, err = padding.UnpadZero(padded)
+	case paddingSchemeNone:
+		plaintext = padded
+	}
+	if err != nil {
+		return fmt.Errorf("failed to remove padding (wrong key, padding or corrupted ciphertext?): %v", err)
+	}
+	if _, err := plaintextWriter.Write(plaintext); err != nil {
+		return fmt.Errorf("failed to write plaintext: %v", err)
+	}
+	return nil
+}
+
+// rejectIVFlagsForECB errors out rather than silently ignoring --iv/--omit-iv,
+// since ECB mode has no initialization vector.
+func rejectIVFlagsForECB(o *Options) error {
+	if o.InitializationVectorFilename != "" || o.OmitInitializationVector {
+		return fmt.Errorf(`the "--%v" and "--%v" flags are not supported in %q mode: it uses no initialization vector`,
+			FlagNameIV, FlagNameOmitIV, cryptoModeECB)
+	}
+	return nil
+}
+
 // CTR mode encryption.
 func encryptCTR(cipherName string, c cipher.Block, plaintext []byte, ciphertextWriter io.Writer, o *Options) error {
-	iv := make([]byte, c.BlockSize())
+	return encryptStream(cipher.NewCTR, c, plaintext, ciphertextWriter, o)
+}
+
+// CTR mode decryption.
+func decryptCTR(cipherName string, c cipher.Block, ciphertext []byte, plaintextWriter io.Writer, o *Options) error {
+	return decryptStream(cipher.NewCTR, c, ciphertext, plaintextWriter, o)
+}
+
+// CFB mode encryption (full-block CFB, i.e. CFB128 for AES and CFB64 for
+// DES/3DES).
+func encryptCFB(cipherName string, c cipher.Block, plaintext []byte, ciphertextWriter io.Writer, o *Options) error {
+	return encryptStream(cipher.NewCFBEncrypter, c, plaintext, ciphertextWriter, o)
+}
+
+// CFB mode decryption.
+func decryptCFB(cipherName string, c cipher.Block, ciphertext []byte, plaintextWriter io.Writer, o *Options) error {
+	return decryptStream(cipher.NewCFBDecrypter, c, ciphertext, plaintextWriter, o)
+}
+
+// OFB mode encryption.
+func encryptOFB(cipherName string, c cipher.Block, plaintext []byte, ciphertextWriter io.Writer, o *Options) error {
+	return encryptStream(cipher.NewOFB, c, plaintext, ciphertextWriter, o)
+}
+
+// OFB mode decryption.
+func decryptOFB(cipherName string, c cipher.Block, ciphertext []byte, plaintextWriter io.Writer, o *Options) error {
+	return decryptStream(cipher.NewOFB, c, ciphertext, plaintextWriter, o)
+}
+
+// encryptStream XORs the plaintext with the key stream of an IV-based stream
+// mode (CTR, CFB, OFB), which needs no padding.
+func encryptStream(newStream func(cipher.Block, []byte) cipher.Stream, c cipher.Block, plaintext []byte, ciphertextWriter io.Writer, o *Options) error {
+	iv, err := readOrGenerateIV(c.BlockSize(), o)
+	if err != nil {
+		return err
+	}
 	ciphertext := make([]byte, len(plaintext))
-	if o.InitializationVectorFilename != "" {
-		if o.InitializationVectorFilename == "-" {
-			return fmt.Errorf(`the "--%v" flag does not support "-" (stdin); provide a file path`, FlagNameIV)
-		}
-		bs, err := os.ReadFile(o.InitializationVectorFilename)
-		if err != nil {
-			return fmt.Errorf(`failed to read "iv" file: %v`, err)
-		}
-		if len(bs) != c.BlockSize() {
-			return fmt.Errorf("invalid initialization vector size %v for block size %v", len(bs), c.BlockSize())
-		}
-		iv = bs
-	} else if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+	newStream(c, iv).XORKeyStream(ciphertext, plaintext)
+	return writeIVAndCiphertext(iv, ciphertext, ciphertextWriter, o)
+}
+
+// decryptStream reverses encryptStream.
+func decryptStream(newStream func(cipher.Block, []byte) cipher.Stream, c cipher.Block, ciphertext []byte, plaintextWriter io.Writer, o *Options) error {
+	iv, ciphertext, err := splitIV(c.BlockSize(), ciphertext, o)
+	if err != nil {
+		return err
+	}
+	plaintext := make([]byte, len(ciphertext))
+	newStream(c, iv).XORKeyStream(plaintext, ciphertext)
+	if _, err := plaintextWriter.Write(plaintext); err != nil {
+		return fmt.Errorf("failed to write plaintext: %v", err)
+	}
+	return nil
+}
+
+// CBC mode encryption, with PKCS#7 padding.
+func encryptCBC(cipherName string, c cipher.Block, plaintext []byte, ciphertextWriter io.Writer, o *Options) error {
+	iv, err := readOrGenerateIV(c.BlockSize(), o)
+	if err != nil {
 		return err
 	}
-	stream := cipher.NewCTR(c, iv)
-	stream.XORKeyStream(ciphertext, plaintext)
+	padded, err := padding.PadPKCS7(plaintext, uint8(c.BlockSize()))
+	if err != nil {
+		return fmt.Errorf("failed to pad plaintext: %v", err)
+	}
+	ciphertext := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(c, iv).CryptBlocks(ciphertext, padded)
+	return writeIVAndCiphertext(iv, ciphertext, ciphertextWriter, o)
+}
+
+// CBC mode decryption, with PKCS#7 padding.
+func decryptCBC(cipherName string, c cipher.Block, ciphertext []byte, plaintextWriter io.Writer, o *Options) error {
+	iv, ciphertext, err := splitIV(c.BlockSize(), ciphertext, o)
+	if err != nil {
+		return err
+	}
+	if len(ciphertext) == 0 || len(ciphertext)%c.BlockSize() != 0 {
+		return fmt.Errorf("%v/decrypt: ciphertext size %vb is not a positive multiple of block size %vb",
+			cipherName, len(ciphertext), c.BlockSize())
+	}
+	padded := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(c, iv).CryptBlocks(padded, ciphertext)
+	plaintext, err := padding.UnpadPKCS7(padded)
+	if err != nil {
+		return fmt.Errorf("failed to remove padding (wrong key or corrupted ciphertext?): %v", err)
+	}
+	if _, err := plaintextWriter.Write(plaintext); err != nil {
+		return fmt.Errorf("failed to write plaintext: %v", err)
+	}
+	return nil
+}
+
+// readOrGenerateIV reads the initialization vector from the "--iv" file, or
+// generates a random one if the flag is omitted.
+func readOrGenerateIV(blockSize int, o *Options) ([]byte, error) {
+	if o.InitializationVectorFilename != "" {
+		return readIVFile(blockSize, o)
+	}
+	iv := make([]byte, blockSize)
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, err
+	}
+	return iv, nil
+}
+
+func readIVFile(blockSize int, o *Options) ([]byte, error) {
+	if o.InitializationVectorFilename == "-" {
+		return nil, fmt.Errorf(`the "--%v" flag does not support "-" (stdin); provide a file path`, FlagNameIV)
+	}
+	bs, err := os.ReadFile(o.InitializationVectorFilename)
+	if err != nil {
+		return nil, fmt.Errorf(`failed to read "iv" file: %v`, err)
+	}
+	if len(bs) != blockSize {
+		return nil, fmt.Errorf("invalid initialization vector size %v for block size %v", len(bs), blockSize)
+	}
+	return bs, nil
+}
+
+// writeIVAndCiphertext prepends the IV to the ciphertext unless "--omit-iv"
+// is given, in which case a generated IV is logged so it isn't lost.
+func writeIVAndCiphertext(iv, ciphertext []byte, ciphertextWriter io.Writer, o *Options) error {
 	output := ciphertext
 	if !o.OmitInitializationVector {
 		output = append(iv, ciphertext...)
@@ -227,34 +580,17 @@ func encryptCTR(cipherName string, c cipher.Block, plaintext []byte, ciphertextW
 	return nil
 }
 
-// CTR mode encryption.
-func decryptCTR(cipherName string, c cipher.Block, ciphertext []byte, plaintextWriter io.Writer, o *Options) error {
-	var iv []byte
-	var plaintext []byte
-	offset := c.BlockSize()
-	if o.InitializationVectorFilename == "" {
-		iv = ciphertext[:offset]
-		plaintext = ciphertext[offset:]
-	} else if o.InitializationVectorFilename == "-" {
-		return fmt.Errorf(`the "--%v" flag does not support "-" (stdin); provide a file path`, FlagNameIV)
-	} else {
-		bs, err := os.ReadFile(o.InitializationVectorFilename)
-		if err != nil {
-			return fmt.Errorf(`failed to read "iv" file: %v`, err)
-		}
-		if len(bs) != c.BlockSize() {
-			return fmt.Errorf("invalid initialization vector size %v for block size %v", len(bs), c.BlockSize())
-		}
-		iv = bs
-		plaintext = ciphertext
-		offset = 0
+// splitIV returns the IV read from the "--iv" file, or else the IV prepended
+// to the ciphertext, along with the remaining ciphertext.
+func splitIV(blockSize int, ciphertext []byte, o *Options) (iv, rest []byte, err error) {
+	if o.InitializationVectorFilename != "" {
+		iv, err := readIVFile(blockSize, o)
+		return iv, ciphertext, err
 	}
-	stream := cipher.NewCTR(c, iv)
-	stream.XORKeyStream(plaintext, ciphertext[offset:])
-	if _, err := plaintextWriter.Write(plaintext); err != nil {
-		return fmt.Errorf("failed to write plaintext: %v", err)
+	if len(ciphertext) < blockSize {
+		return nil, nil, fmt.Errorf("ciphertext too short: %v bytes, need at least %v for the initialization vector", len(ciphertext), blockSize)
 	}
-	return nil
+	return ciphertext[:blockSize], ciphertext[blockSize:], nil
 }
 
 // GCM AEAD mode encryption.
@@ -263,46 +599,76 @@ func encryptGCMAEAD(cipherName string, c cipher.Block, plaintext []byte, ciphert
 	if err != nil {
 		return fmt.Errorf("failed to initialize GCM AEAD mode: %v", err)
 	}
-	if err := rejectIVFlagsForGCM(o); err != nil {
+	if err := rejectIVFlagForGCMEncryption(o); err != nil {
 		return err
 	}
 	nonceSize := gcm.NonceSize()
-	// GCM generates a fresh nonce per encryption and always prepends it to
-	// the ciphertext.
+	// GCM generates a fresh nonce per encryption and prepends it to the
+	// ciphertext, unless "--omit-iv" is given.
 	nonce := make([]byte, nonceSize)
 	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
 		return fmt.Errorf("failed to generate nonce of size %v: %v", nonceSize, err)
 	}
-	additionalData, err := readAdditionalData(o.AdditionalDataFilename)
+	additionalData, err := readAEADAdditionalData(o)
 	if err != nil {
 		return err
 	}
 	ciphertext := gcm.Seal(nil, nonce, plaintext, additionalData)
-	if _, err := ciphertextWriter.Write(nonce); err != nil {
-		return fmt.Errorf("failed to write nonce: %v", err)
+	if o.TagFilename != "" {
+		tagOffset := len(ciphertext) - gcm.Overhead()
+		if err := writeTagFile(o.TagFilename, ciphertext[tagOffset:]); err != nil {
+			return err
+		}
+		ciphertext = ciphertext[:tagOffset]
 	}
-	if _, err := ciphertextWriter.Write(ciphertext); err != nil {
-		return fmt.Errorf("failed to write ciphertext: %v", err)
+	return writeIVAndCiphertext(nonce, ciphertext, ciphertextWriter, o)
+}
+
+// rejectIVFlagForGCMEncryption errors out rather than silently ignoring --iv
+// when encrypting in GCM mode: the nonce is always random, since reusing a
+// user-supplied GCM nonce under the same key is catastrophic.
+func rejectIVFlagForGCMEncryption(o *Options) error {
+	if o.InitializationVectorFilename != "" {
+		return fmt.Errorf(`the "--%v" flag is not supported when encrypting in %q mode: a random nonce is always generated (use "--%v" to detach it from the ciphertext)`,
+			FlagNameIV, cryptoModeGCM, FlagNameOmitIV)
 	}
 	return nil
 }
 
-// TODO: support "--omit-iv" for GCM mode (stop prepending the nonce to
-// ciphertext, logging it via log.Printf like CTR mode does) plus "--iv" on
-// decrypt only (read the nonce back from a file). Keep "--iv" on encrypt
-// rejected, since a user-supplied GCM nonce risks catastrophic reuse.
-
-// rejectIVFlagsForGCM errors out rather than silently ignoring --iv/--omit-iv
-// in GCM mode: the nonce is always random and always prepended to the
-// ciphertext, so honoring either flag would be misleading.
-func rejectIVFlagsForGCM(o *Options) error {
-	if o.InitializationVectorFilename != "" || o.OmitInitializationVector {
-		return fmt.Errorf(`the "--%v" and "--%v" flags are not supported in %q mode: a random nonce is always generated and prepended to the ciphertext`,
-			FlagNameIV, FlagNameOmitIV, cryptoModeGCM)
+// writeTagFile writes a detached authentication tag, refusing to overwrite
+// an existing file.
+func writeTagFile(filename string, tag []byte) error {
+	if filename == "-" {
+		return fmt.Errorf(`the "--%v" flag does not support "-" (stdout); provide a file path`, FlagNameTagFile)
+	}
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open tag file %q for writing: %v", filename, err)
+	}
+	if _, err := f.Write(tag); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write tag file: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close tag file: %v", err)
 	}
 	return nil
 }
 
+func readTagFile(filename string, tagSize int) ([]byte, error) {
+	if filename == "-" {
+		return nil, fmt.Errorf(`the "--%v" flag does not support "-" (stdin); provide a file path`, FlagNameTagFile)
+	}
+	bs, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tag file: %v", err)
+	}
+	if len(bs) != tagSize {
+		return nil, fmt.Errorf("invalid authentication tag size %v, expected %v", len(bs), tagSize)
+	}
+	return bs, nil
+}
+
 func readAdditionalData(filename string) ([]byte, error) {
 	if filename != "" {
 		if filename == "-" {
@@ -317,25 +683,34 @@ func readAdditionalData(filename string) ([]byte, error) {
 	return nil, nil
 }
 
-// GCM AEAD mode decryption.
+// GCM AEAD mode decryption. The nonce is read from the "--iv" file if given,
+// otherwise from the front of the ciphertext; likewise the tag is read from
+// the "--tag-file" if given, otherwise from the end.
 func decryptGCMAEAD(cipherName string, c cipher.Block, ciphertext []byte, plaintextWriter io.Writer, o *Options) error {
 	gcm, err := cipher.NewGCM(c)
 	if err != nil {
 		return fmt.Errorf("failed to create new GCM AEAD: %v", err)
 	}
-	if err := rejectIVFlagsForGCM(o); err != nil {
+	if o.OmitInitializationVector && o.InitializationVectorFilename == "" {
+		return fmt.Errorf(`the "--%v" flag requires "--%v" when decrypting in %q mode: provide the detached nonce`,
+			FlagNameOmitIV, FlagNameIV, cryptoModeGCM)
+	}
+	nonce, ciphertext, err := splitIV(gcm.NonceSize(), ciphertext, o)
+	if err != nil {
 		return err
 	}
-	nonceSize := gcm.NonceSize()
-	if len(ciphertext) < nonceSize {
-		return fmt.Errorf("ciphertext too short: %v bytes, need at least %v for the nonce", len(ciphertext), nonceSize)
+	if o.TagFilename != "" {
+		tag, err := readTagFile(o.TagFilename, gcm.Overhead())
+		if err != nil {
+			return err
+		}
+		ciphertext = append(ciphertext[:len(ciphertext):len(ciphertext)], tag...)
 	}
-	nonce := ciphertext[:nonceSize]
-	additionalData, err := readAdditionalData(o.AdditionalDataFilename)
+	additionalData, err := readAEADAdditionalData(o)
 	if err != nil {
 		return err
 	}
-	plaintext, err := gcm.Open(nil, nonce, ciphertext[nonceSize:], additionalData)
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, additionalData)
 	if err != nil {
 		return fmt.Errorf("%v", err)
 	}
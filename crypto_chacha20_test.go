@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"path"
+	"strings"
+	"testing"
+)
+
+const sunscreen = "Ladies and Gentlemen of the class of '99: If I could offer you only one tip for the future, sunscreen would be it."
+
+// Decryption must accept the RFC 8439 section 2.8.2 AEAD test vector (and
+// the XChaCha20-Poly1305 vector of draft-irtf-cfrg-xchacha appendix A.3.1)
+// with the nonce prepended.
+func TestChaCha20KnownAnswer(t *testing.T) {
+	tempDir := t.TempDir()
+	keyFilename := path.Join(tempDir, "key")
+	mustWrite(t, keyFilename, mustHex("808182838485868788898a8b8c8d8e8f909192939495969798999a9b9c9d9e9f"))
+	adFilename := path.Join(tempDir, "ad")
+	mustWrite(t, adFilename, mustHex("50515253c0c1c2c3c4c5c6c7"))
+
+	for _, eg := range []struct {
+		cmdName, nonce, ciphertext, tag string
+	}{
+		{"chacha20", "070000004041424344454647",
+			"d31a8d34648e60db7b86afbc53ef7ec2a4aded51296e08fea9e2b5a736ee62d63dbea45e8ca9671282fafb69da92728b" +
+				"1a71de0a9e060b2905d6a5b67ecd3b3692ddbd7f2d778b8c9803aee328091b58fab324e4fad675945585808b4831d7bc" +
+				"3ff4def08e4b7a9de576d26586cec64b6116",
+			"1ae10b594f09e26a7e902ecbd0600691"},
+		{"xchacha20", "404142434445464748494a4b4c4d4e4f5051525354555657",
+			"bd6d179d3e83d43b9576579493c0e939572a1700252bfaccbed2902c21396cbb731c7f1b0b4aa6440bf3a82f4eda7e39" +
+				"ae64c6708c54c216cb96b72e1213b4522f8c9ba40db5d945b11b69b982c1bb9e3f3fac2bc369488f76b2383565d3fff9" +
+				"21f9664c97637da9768812f615c68b13b52e",
+			"c0875924c1c7987947deafd8780acf49"},
+	} {
+		input := mustHex(eg.nonce + eg.ciphertext + eg.tag)
+		args := []string{eg.cmdName, "--decrypt", "--key", keyFilename, "--additional-data", adFilename}
+		plaintext, err := runSymmetricCmd(t, args, input)
+		if err != nil {
+			t.Fatalf("args=%#v: unexpected decryption error: %v", args, err)
+		}
+		if string(plaintext) != sunscreen {
+			t.Fatalf("args=%#v: wanted %q, got %q", args, sunscreen, plaintext)
+		}
+
+		// Any change to the additional data fails authentication.
+		mustWrite(t, adFilename, mustHex("50515253c0c1c2c3c4c5c6c8"))
+		_, err = runSymmetricCmd(t, args, input)
+		mustWrite(t, adFilename, mustHex("50515253c0c1c2c3c4c5c6c7"))
+		if err == nil || !strings.Contains(err.Error(), "message authentication failed") {
+			t.Fatalf("args=%#v: expected an authentication error, got %v", args, err)
+		}
+	}
+}
+
+func TestChaCha20RoundTrip(t *testing.T) {
+	tempDir := t.TempDir()
+	keyFilename := path.Join(tempDir, "key")
+	mustWrite(t, keyFilename, mustRand(32))
+	adFilename := path.Join(tempDir, "ad")
+	mustWrite(t, adFilename, []byte("header"))
+
+	for _, eg := range []struct {
+		args      []string
+		nonceSize int
+	}{
+		{[]string{"chacha20"}, 12},
+		{[]string{"chacha20", "--additional-data", adFilename}, 12},
+		{[]string{"xchacha20"}, 24},
+		{[]string{"xchacha20", "--additional-data", adFilename}, 24},
+	} {
+		for _, message := range testMessages {
+			args := append(eg.args, "--key", keyFilename)
+			ciphertext, err := runSymmetricCmd(t, args, message)
+			if err != nil {
+				t.Fatalf("args=%#v: unexpected encryption error: %v", args, err)
+			}
+			if len(ciphertext) != eg.nonceSize+len(message)+16 {
+				t.Fatalf("args=%#v: wanted %v bytes of nonce, ciphertext and tag, got %v",
+					args, eg.nonceSize+len(message)+16, len(ciphertext))
+			}
+			plaintext, err := runSymmetricCmd(t, append(args, "--decrypt"), ciphertext)
+			if err != nil {
+				t.Fatalf("args=%#v: unexpected decryption error: %v", args, err)
+			}
+			if !bytes.Equal(plaintext, message) {
+				t.Fatalf("args=%#v: roundtrip failed: wanted %q, got %q", args, message, plaintext)
+			}
+		}
+	}
+}
+
+func TestChaCha20Errors(t *testing.T) {
+	tempDir := t.TempDir()
+	keyFilename := path.Join(tempDir, "key")
+	mustWrite(t, keyFilename, mustRand(32))
+	shortKeyFilename := path.Join(tempDir, "short.key")
+	mustWrite(t, shortKeyFilename, mustRand(16))
+
+	for _, tc := range []struct {
+		args  []string
+		input []byte
+		err   string
+	}{
+		{[]string{"chacha20"}, nil, `missing required "--key" flag`},
+		{[]string{"chacha20", "--key", shortKeyFilename}, nil,
+			"failed to create ChaCha20-Poly1305 cipher: chacha20poly1305: bad key length"},
+		{[]string{"xchacha20", "--decrypt", "--key", keyFilename}, make([]byte, 39),
+			"ciphertext too short: 39 bytes, need at least 40 for the nonce and tag"},
+		{[]string{"chacha20", "--key", keyFilename, "--additional-data", "-"}, nil,
+			`the "--additional-data" flag does not support "-"`},
+	} {
+		_, err := runSymmetricCmd(t, tc.args, tc.input)
+		if err == nil {
+			t.Fatalf("args=%#v: expected error containing %q, got nil", tc.args, tc.err)
+		}
+		if !strings.Contains(err.Error(), tc.err) {
+			t.Fatalf("args=%#v: expected error containing %q, got %q", tc.args, tc.err, err.Error())
+		}
+	}
+}
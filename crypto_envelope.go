@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+)
+
+const FlagNameEnvelope = "envelope"
+
+// The envelope is an optional self-describing header written in front of
+// everything else (including the password header) by "--envelope":
+//
+//	magic "encenv" (6 bytes) || version 1 (1 byte) ||
+//	JSON length (2 bytes, big-endian) || JSON envelopeHeader
+//
+// Decryption detects it by its magic and uses it to select the mode. The
+// AEAD modes (gcm, gcm-stream, gcm-siv and siv) authenticate the serialized
+// envelope along with any "--additional-data", so a tampered envelope fails
+// decryption; in the other modes nothing, the envelope included, is
+// authenticated.
+var envelopeMagic = []byte("encenv")
+
+const envelopeVersion = 1
+
+type envelopeHeader struct {
+	Cipher         string `json:"cipher"`
+	Mode           string `json:"mode"`
+	KeySize        int    `json:"keySize"`
+	NonceSize      int    `json:"nonceSize"`
+	AdditionalData bool   `json:"additionalData"`
+	DetachedTag    bool   `json:"detachedTag,omitempty"`
+	Padding        string `json:"padding,omitempty"`
+	KDF            string `json:"kdf,omitempty"`
+}
+
+// newEnvelope encodes the envelope describing an encryption with options o.
+func newEnvelope(cipherName string, c cipher.Block, keySize int, o *Options) ([]byte, error) {
+	header := envelopeHeader{
+		Cipher:         cipherName,
+		Mode:           string(o.CryptoMode),
+		KeySize:        keySize,
+		NonceSize:      envelopeNonceSize(c, o),
+		AdditionalData: o.AdditionalDataFilename != "",
+		DetachedTag:    o.TagFilename != "",
+	}
+	if o.CryptoMode == cryptoModeECB {
+		header.Padding = string(paddingSchemePKCS7)
+		if o.Padding != "" {
+			header.Padding = string(o.Padding)
+		}
+	}
+	if usePassword(o) {
+		header.KDF = "pbkdf2"
+	}
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode envelope: %v", err)
+	}
+	envelope := append([]byte{}, envelopeMagic...)
+	envelope = append(envelope, envelopeVersion)
+	envelope = binary.BigEndian.AppendUint16(envelope, uint16(len(headerJSON)))
+	return append(envelope, headerJSON...), nil
+}
+
+// envelopeNonceSize is the size of the IV or nonce carried in the output,
+// which is zero when it is omitted.
+func envelopeNonceSize(c cipher.Block, o *Options) int {
+	switch o.CryptoMode {
+	case cryptoModeBlock, cryptoModeECB, cryptoModeSIV:
+		return 0
+	case cryptoModeGCM:
+		if gcm, err := cipher.NewGCM(c); err == nil && !o.OmitInitializationVector {
+			return gcm.NonceSize()
+		}
+		return 0
+	case cryptoModeGCMStream:
+		return gcmStreamPrefixSize
+	case cryptoModeGCMSIV:
+		if o.OmitInitializationVector {
+			return 0
+		}
+		return gcmSIVNonceSize
+	}
+	if o.OmitInitializationVector {
+		return 0
+	}
+	return c.BlockSize()
+}
+
+// readEnvelope consumes and returns the envelope at the start of r, and its
+// serialized bytes, or nil if r does not start with one. Every decryption
+// input is checked, so ciphertext that happens to start with the magic
+// "encenv" is always treated as an envelope, and fails to decrypt if it is
+// not a valid one.
+func readEnvelope(r *bufio.Reader) (*envelopeHeader, []byte, error) {
+	magic, err := r.Peek(len(envelopeMagic))
+	if errors.Is(err, io.EOF) || !bytes.Equal(magic, envelopeMagic) {
+		return nil, nil, nil
+	} else if err != nil {
+		return nil, nil, fmt.Errorf("failed to read envelope: %v", err)
+	}
+	prefix := make([]byte, len(envelopeMagic)+3)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return nil, nil, fmt.Errorf("failed to read envelope: %v", err)
+	}
+	if version := prefix[len(envelopeMagic)]; version != envelopeVersion {
+		return nil, nil, fmt.Errorf("unsupported envelope version %v", version)
+	}
+	headerJSON := make([]byte, binary.BigEndian.Uint16(prefix[len(envelopeMagic)+1:]))
+	if _, err := io.ReadFull(r, headerJSON); err != nil {
+		return nil, nil, fmt.Errorf("failed to read envelope: %v", err)
+	}
+	var header envelopeHeader
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse envelope JSON: %v", err)
+	}
+	return &header, append(prefix, headerJSON...), nil
+}
+
+// readAEADAdditionalData returns the additional data the AEAD modes
+// authenticate: the serialized envelope, if any, followed by the contents of
+// the "--additional-data" file. The envelope encodes its own length, so the
+// two cannot be confused.
+func readAEADAdditionalData(o *Options) ([]byte, error) {
+	additionalData, err := readAdditionalData(o.AdditionalDataFilename)
+	if err != nil || o.EnvelopeBytes == nil {
+		return additionalData, err
+	}
+	return append(append([]byte{}, o.EnvelopeBytes...), additionalData...), nil
+}
+
+// applyEnvelope checks the envelope against the decryption options and
+// selects its mode, unless "--mode" was given explicitly and disagrees. Only
+// the AEAD modes, which authenticate the envelope, are taken from it alone:
+// anyone can rewrite an envelope to name an unauthenticated mode, such as
+// "ctr" over a "gcm" ciphertext, so those must be named by "--mode" too.
+func applyEnvelope(cmd *cobra.Command, header *envelopeHeader, cipherName string, o *Options) error {
+	if header.Cipher != cipherName {
+		return fmt.Errorf("envelope cipher %q does not match %v", header.Cipher, cipherName)
+	}
+	mode := cryptoMode(header.Mode)
+	if cmd.Flags().Changed("mode") {
+		if mode != o.CryptoMode {
+			return fmt.Errorf("envelope mode %q does not match expected --mode=%q", mode, o.CryptoMode)
+		}
+	} else if err := mode.Set(header.Mode); err != nil {
+		return fmt.Errorf("envelope has invalid mode %q: %v", header.Mode, err)
+	} else if !isAEADMode(mode) {
+		return fmt.Errorf(`envelope mode %q is not authenticated: provide "--mode=%v" to decrypt it anyway`, mode, mode)
+	}
+	o.CryptoMode = mode
+
+	if header.KDF != "" && !usePassword(o) {
+		return fmt.Errorf(`ciphertext is password-encrypted: provide "--%v" or "--%v"`, FlagNamePasswordFile, FlagNamePasswordEnv)
+	} else if header.KDF == "" && usePassword(o) {
+		return fmt.Errorf(`ciphertext is not password-encrypted: provide "--%v" instead`, FlagNameKey)
+	}
+	if header.AdditionalData && o.AdditionalDataFilename == "" {
+		return fmt.Errorf(`ciphertext was encrypted with additional data: provide "--additional-data"`)
+	} else if !header.AdditionalData && o.AdditionalDataFilename != "" {
+		return fmt.Errorf(`ciphertext was encrypted without additional data: omit "--additional-data"`)
+	}
+	if header.NonceSize == 0 && usesIVFile(mode) && o.InitializationVectorFilename == "" {
+		return fmt.Errorf(`ciphertext was encrypted with "--%v": provide "--%v"`, FlagNameOmitIV, FlagNameIV)
+	}
+	if header.DetachedTag && o.TagFilename == "" {
+		return fmt.Errorf(`ciphertext was encrypted with "--%v": provide "--%v"`, FlagNameTagFile, FlagNameTagFile)
+	}
+	if header.Padding != "" && o.Padding == "" {
+		o.Padding = paddingScheme(header.Padding)
+	}
+	return nil
+}
+
+// isAEADMode reports whether mode authenticates the ciphertext and the
+// envelope.
+func isAEADMode(mode cryptoMode) bool {
+	switch mode {
+	case cryptoModeGCM, cryptoModeGCMStream, cryptoModeGCMSIV, cryptoModeSIV:
+		return true
+	}
+	return false
+}
+
+func usesIVFile(mode cryptoMode) bool {
+	switch mode {
+	case cryptoModeCBC, cryptoModeCFB, cryptoModeCTR, cryptoModeOFB, cryptoModeGCM, cryptoModeGCMSIV:
+		return true
+	}
+	return false
+}
+
+func addInspectCmd(cryptoCmd *cobra.Command) {
+	inspectCmd := &cobra.Command{
+		Use:   "inspect",
+		Short: "Print the envelope of ciphertext encrypted with --" + FlagNameEnvelope + " as JSON, without decrypting",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			r := bufio.NewReader(cmd.InOrStdin())
+			header, _, err := readEnvelope(r)
+			if err != nil {
+				return err
+			}
+			if header == nil {
+				return fmt.Errorf("input has no envelope (missing %q header; was it encrypted with --%v?)", envelopeMagic, FlagNameEnvelope)
+			}
+
+			out := struct {
+				Version int `json:"version"`
+				envelopeHeader
+				Iterations uint32 `json:"iterations,omitempty"`
+				Salt       string `json:"salt,omitempty"`
+			}{Version: envelopeVersion, envelopeHeader: *header}
+			if header.KDF != "" {
+				passwordHeader := make([]byte, passwordHeaderSize)
+				if _, err := io.ReadFull(r, passwordHeader); err != nil {
+					return fmt.Errorf("failed to read password header: %v", err)
+				}
+				if !bytes.HasPrefix(passwordHeader, passwordHeaderMagic) {
+					return fmt.Errorf("envelope declares a password but the %q header is missing", passwordHeaderMagic)
+				}
+				out.Iterations = binary.BigEndian.Uint32(passwordHeader[len(passwordHeaderMagic)+1:])
+				out.Salt = hex.EncodeToString(passwordHeader[passwordHeaderSize-passwordSaltSize:])
+			}
+
+			b, err := json.MarshalIndent(out, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to encode output: %v", err)
+			}
+			w := cmd.OutOrStdout()
+			if _, err := w.Write(b); err != nil {
+				return fmt.Errorf("failed to write output: %v", err)
+			}
+			if _, err := io.WriteString(w, "\n"); err != nil {
+				return fmt.Errorf("failed to write output: %v", err)
+			}
+			return nil
+		},
+	}
+
+	cryptoCmd.AddCommand(inspectCmd)
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	tempDir := t.TempDir()
+	keys := map[string]string{}
+	for name, size := range map[string]int{"aes": 32, "des": 8, "des3": 24} {
+		keys[name] = path.Join(tempDir, name+".key")
+		mustWrite(t, keys[name], mustRand(size))
+	}
+	additionalDataFilename := path.Join(tempDir, "ad.txt")
+	mustWrite(t, additionalDataFilename, []byte("header"))
+	t.Setenv("ENC_TEST_PASSWORD", "correct horse battery staple")
+	message := []byte("Hello, envelope! ✉️")
+
+	for _, tc := range []struct {
+		args        []string
+		decryptArgs []string
+	}{
+		{args: []string{"aes", "--mode", "gcm"}},
+		{args: []string{"aes", "--mode", "gcm", "--additional-data", additionalDataFilename},
+			decryptArgs: []string{"--additional-data", additionalDataFilename}},
+		{args: []string{"aes", "--mode", "gcm-stream"}},
+		{args: []string{"aes", "--mode", "cbc"}},
+		{args: []string{"aes", "--mode", "ctr"}},
+		{args: []string{"aes", "--mode", "ecb", "--padding", "zero"}},
+		{args: []string{"des", "--mode", "cfb"}},
+		{args: []string{"des3", "--mode", "ofb"}},
+	} {
+		args := append(tc.args, "--envelope", "--key", keys[tc.args[0]])
+		ciphertext, err := runSymmetricCmd(t, args, message)
+		if err != nil {
+			t.Fatalf("args=%#v: unexpected encryption error: %v", args, err)
+		}
+		if !bytes.HasPrefix(ciphertext, envelopeMagic) {
+			t.Fatalf("args=%#v: ciphertext is missing the envelope", args)
+		}
+
+		// The padding, and any AEAD mode, are read back from the envelope.
+		decryptArgs := append([]string{tc.args[0], "--decrypt", "--key", keys[tc.args[0]]}, tc.decryptArgs...)
+		if mode := cryptoMode(tc.args[2]); !isAEADMode(mode) {
+			decryptArgs = append(decryptArgs, "--mode", string(mode))
+		}
+		plaintext, err := runSymmetricCmd(t, decryptArgs, ciphertext)
+		if err != nil {
+			t.Fatalf("args=%#v: unexpected decryption error: %v", decryptArgs, err)
+		}
+		if !bytes.Equal(plaintext, message) {
+			t.Fatalf("args=%#v: roundtrip failed: wanted %q, got %q", args, message, plaintext)
+		}
+	}
+
+	// The envelope goes in front of the password header.
+	ciphertext, err := runSymmetricCmd(t, []string{"aes", "--mode", "cbc", "--envelope",
+		"--password-env", "ENC_TEST_PASSWORD", "--iterations", "1000"}, message)
+	if err != nil {
+		t.Fatalf("unexpected encryption error: %v", err)
+	}
+	plaintext, err := runSymmetricCmd(t, []string{"aes", "--decrypt", "--mode", "cbc", "--password-env", "ENC_TEST_PASSWORD"}, ciphertext)
+	if err != nil {
+		t.Fatalf("unexpected decryption error: %v", err)
+	}
+	if !bytes.Equal(plaintext, message) {
+		t.Fatalf("password roundtrip failed: wanted %q, got %q", message, plaintext)
+	}
+}
+
+// The AEAD modes authenticate the envelope, so an edited envelope, even one
+// meaning the same, or a stripped one fails decryption.
+func TestEnvelopeAuthenticated(t *testing.T) {
+	tempDir := t.TempDir()
+	keyFilename := path.Join(tempDir, "aes.key")
+	mustWrite(t, keyFilename, mustRand(32))
+	additionalDataFilename := path.Join(tempDir, "ad.txt")
+	mustWrite(t, additionalDataFilename, []byte("header"))
+
+	for _, mode := range []string{"gcm", "gcm-stream", "gcm-siv", "siv"} {
+		for _, extraArgs := range [][]string{nil, {"--additional-data", additionalDataFilename}} {
+			args := append([]string{"aes", "--mode", mode, "--key", keyFilename}, extraArgs...)
+			ciphertext, err := runSymmetricCmd(t, append(args, "--envelope"), []byte("Hello, envelope! ✉️"))
+			if err != nil {
+				t.Fatalf("args=%#v: unexpected encryption error: %v", args, err)
+			}
+			envelopeSize := len(envelopeMagic) + 3 + int(ciphertext[len(envelopeMagic)+1])<<8 + int(ciphertext[len(envelopeMagic)+2])
+
+			// Reformat the JSON with a space, adjusting its length.
+			tampered := append([]byte{}, ciphertext[:len(envelopeMagic)+3]...)
+			tampered = append(tampered, ' ')
+			tampered = append(tampered, ciphertext[len(envelopeMagic)+3:]...)
+			tampered[len(envelopeMagic)+2]++
+
+			for name, input := range map[string][]byte{
+				"reformatted envelope": tampered,
+				"stripped envelope":    ciphertext[envelopeSize:],
+			} {
+				_, err := runSymmetricCmd(t, append(args, "--decrypt"), input)
+				if err == nil || !strings.Contains(err.Error(), "message authentication failed") {
+					t.Fatalf("args=%#v, %v: expected an authentication error, got %v", args, name, err)
+				}
+			}
+		}
+	}
+}
+
+// An envelope rewritten to name an unauthenticated mode must not downgrade
+// the decryption of an AEAD ciphertext: "ctr" with the GCM nonce and counter
+// 2 would decrypt it without checking the tag.
+func TestEnvelopeModeDowngrade(t *testing.T) {
+	keyFilename := path.Join(t.TempDir(), "aes.key")
+	mustWrite(t, keyFilename, mustRand(32))
+
+	ciphertext, err := runSymmetricCmd(t, []string{"aes", "--mode", "gcm", "--envelope", "--key", keyFilename}, []byte("Hello, envelope! ✉️"))
+	if err != nil {
+		t.Fatalf("unexpected encryption error: %v", err)
+	}
+	rewritten := bytes.Replace(ciphertext, []byte(`"mode":"gcm"`), []byte(`"mode":"ctr"`), 1)
+	if bytes.Equal(rewritten, ciphertext) {
+		t.Fatalf("envelope %q has no gcm mode to rewrite", ciphertext)
+	}
+
+	_, err = runSymmetricCmd(t, []string{"aes", "--decrypt", "--key", keyFilename}, rewritten)
+	if err == nil || !strings.Contains(err.Error(), `envelope mode "ctr" is not authenticated`) {
+		t.Fatalf("expected a refusal to take ctr mode from the envelope, got %v", err)
+	}
+}
+
+func TestEnvelopeErrors(t *testing.T) {
+	tempDir := t.TempDir()
+	keyFilename := path.Join(tempDir, "aes.key")
+	mustWrite(t, keyFilename, mustRand(32))
+	shortKeyFilename := path.Join(tempDir, "aes128.key")
+	mustWrite(t, shortKeyFilename, mustRand(16))
+	additionalDataFilename := path.Join(tempDir, "ad.txt")
+	mustWrite(t, additionalDataFilename, []byte("header"))
+	t.Setenv("ENC_TEST_PASSWORD", "hunter2")
+
+	encryptWith := func(args ...string) []byte {
+		t.Helper()
+		ciphertext, err := runSymmetricCmd(t, append([]string{"aes", "--envelope"}, args...), []byte("secret"))
+		if err != nil {
+			t.Fatalf("args=%#v: unexpected encryption error: %v", args, err)
+		}
+		return ciphertext
+	}
+	cbc := encryptWith("--mode", "cbc", "--key", keyFilename)
+	gcmWithAD := encryptWith("--key", keyFilename, "--additional-data", additionalDataFilename)
+	ctrOmitIV := encryptWith("--mode", "ctr", "--omit-iv", "--key", keyFilename)
+	password := encryptWith("--password-env", "ENC_TEST_PASSWORD", "--iterations", "1000")
+	gcmDetachedTag := encryptWith("--key", keyFilename, "--tag-file", path.Join(tempDir, "gcm.tag"))
+
+	for _, tc := range []struct {
+		args       []string
+		ciphertext []byte
+		err        string
+	}{
+		{[]string{"aes", "--decrypt", "--mode", "gcm", "--key", keyFilename}, cbc,
+			`envelope mode "cbc" does not match expected --mode="gcm"`},
+		{[]string{"des3", "--decrypt", "--key", keyFilename}, cbc,
+			`envelope cipher "AES" does not match 3DES`},
+		{[]string{"aes", "--decrypt", "--mode", "cbc", "--key", shortKeyFilename}, cbc,
+			"key size 16 bytes does not match the envelope's 32 bytes"},
+		{[]string{"aes", "--decrypt", "--key", keyFilename}, gcmWithAD,
+			`provide "--additional-data"`},
+		{[]string{"aes", "--decrypt", "--mode", "cbc", "--key", keyFilename, "--additional-data", additionalDataFilename}, cbc,
+			`omit "--additional-data"`},
+		{[]string{"aes", "--decrypt", "--key", keyFilename}, cbc,
+			`envelope mode "cbc" is not authenticated: provide "--mode=cbc"`},
+		{[]string{"aes", "--decrypt", "--mode", "ctr", "--key", keyFilename}, ctrOmitIV,
+			`provide "--iv"`},
+		{[]string{"aes", "--decrypt", "--key", keyFilename}, gcmDetachedTag,
+			`provide "--tag-file"`},
+		{[]string{"aes", "--decrypt", "--key", keyFilename}, password,
+			`ciphertext is password-encrypted`},
+		{[]string{"aes", "--decrypt", "--mode", "cbc", "--password-env", "ENC_TEST_PASSWORD"}, cbc,
+			`ciphertext is not password-encrypted`},
+		{[]string{"aes", "--envelope", "--openssl", "--password-env", "ENC_TEST_PASSWORD"}, []byte("secret"),
+			`the "--envelope" flag cannot be combined with "--openssl"`},
+	} {
+		_, err := runSymmetricCmd(t, tc.args, tc.ciphertext)
+		if err == nil {
+			t.Fatalf("args=%#v: expected error containing %q, got nil", tc.args, tc.err)
+		}
+		if !strings.Contains(err.Error(), tc.err) {
+			t.Fatalf("args=%#v: expected error containing %q, got %q", tc.args, tc.err, err.Error())
+		}
+	}
+}
+
+func TestEnvelopeInspect(t *testing.T) {
+	keyFilename := path.Join(t.TempDir(), "aes.key")
+	mustWrite(t, keyFilename, mustRand(32))
+	t.Setenv("ENC_TEST_PASSWORD", "hunter2")
+
+	ciphertext, err := runSymmetricCmd(t, []string{"aes", "--envelope", "--mode", "ecb", "--key", keyFilename}, []byte("secret"))
+	if err != nil {
+		t.Fatalf("unexpected encryption error: %v", err)
+	}
+	out, err := runSymmetricCmd(t, []string{"aes", "inspect"}, ciphertext)
+	if err != nil {
+		t.Fatalf("unexpected inspect error: %v", err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatalf("failed to parse inspect output %q: %v", out, err)
+	}
+	want := map[string]any{
+		"version":        float64(1),
+		"cipher":         "AES",
+		"mode":           "ecb",
+		"keySize":        float64(32),
+		"nonceSize":      float64(0),
+		"additionalData": false,
+		"padding":        "pkcs7",
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("inspect %q: wanted %v, got %v", k, v, got[k])
+		}
+	}
+	if _, ok := got["kdf"]; ok {
+		t.Errorf("inspect: unexpected kdf for key-encrypted ciphertext")
+	}
+
+	ciphertext, err = runSymmetricCmd(t, []string{"aes", "--envelope",
+		"--password-env", "ENC_TEST_PASSWORD", "--iterations", "1234"}, []byte("secret"))
+	if err != nil {
+		t.Fatalf("unexpected encryption error: %v", err)
+	}
+	out, err = runSymmetricCmd(t, []string{"aes", "inspect"}, ciphertext)
+	if err != nil {
+		t.Fatalf("unexpected inspect error: %v", err)
+	}
+	got = nil
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatalf("failed to parse inspect output %q: %v", out, err)
+	}
+	if got["mode"] != "gcm" || got["nonceSize"] != float64(12) || got["kdf"] != "pbkdf2" || got["iterations"] != float64(1234) {
+		t.Errorf("inspect: unexpected output %s", out)
+	}
+	if salt, _ := got["salt"].(string); len(salt) != 2*passwordSaltSize {
+		t.Errorf("inspect: wanted a %v-byte hex salt, got %q", passwordSaltSize, got["salt"])
+	}
+
+	if _, err := runSymmetricCmd(t, []string{"aes", "inspect"}, []byte("no envelope here")); err == nil ||
+		!strings.Contains(err.Error(), "input has no envelope") {
+		t.Fatalf("expected missing envelope error, got %v", err)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	FlagNameEncoding = "encoding"
+
+	FilenameDescriptionKey = "key"
+
+	// DefaultHMACKeySize matches the output of SHA-512, the largest HS*
+	// algorithm, so one secret suits all of them.
+	DefaultHMACKeySize = 64
+)
+
+var keyEncodingNames = []string{"raw", "hex", "base64"}
+
+// addSymmetricGenerateCmd adds a "generate" subcommand writing a random key
+// for the given cipher to a new file, like "rsa generate" does for key pairs.
+func addSymmetricGenerateCmd(cryptoCmd *cobra.Command, cipherName string, keySize int) {
+	var keyFilename string
+	var sizeBits int
+	var encoding string
+
+	generateCmd := &cobra.Command{
+		Use:     "generate",
+		Aliases: []string{"gen"},
+		Short:   "Generate a random " + cipherName + " key",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			size := keySize
+			if cipherName == CipherNameAES {
+				switch sizeBits {
+				case 128, 192, 256:
+					size = sizeBits / 8
+				default:
+					return fmt.Errorf(`invalid "--size" flag %v: must be one of 128, 192, 256`, sizeBits)
+				}
+			}
+			key, err := generateSymmetricKey(cipherName, size)
+			if err != nil {
+				return err
+			}
+			return writeSymmetricKey(cmd, keyFilename, key, encoding)
+		},
+	}
+
+	generateCmd.Flags().StringVarP(&keyFilename, FlagNameKey, "k", "-",
+		"file to write the key to")
+	generateCmd.Flags().StringVarP(&encoding, FlagNameEncoding, "e", "raw",
+		"key encoding: "+strings.Join(keyEncodingNames, ", ")+` ("--key" files must be raw)`)
+	if cipherName == CipherNameAES {
+		generateCmd.Flags().IntVarP(&sizeBits, "size", "s", 256,
+			"key size in bits: 128, 192, 256")
+	}
+
+	cryptoCmd.AddCommand(generateCmd)
+}
+
+// addJWTGenerateSecretCmd adds a subcommand writing a random HMAC secret for
+// the HS* algorithms.
+func addJWTGenerateSecretCmd(jwtCmd *cobra.Command) {
+	var keyFilename string
+	var size int
+	var encoding string
+
+	generateCmd := &cobra.Command{
+		Use:     "generate-secret",
+		Aliases: []string{"generate", "gen"},
+		Short:   "Generate a random HMAC secret for the HS* algorithms",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			// RFC 7518, section 3.2: a key at least as long as the hash output.
+			if size < 32 {
+				return fmt.Errorf(`invalid "--size" flag %v: must be at least 32 bytes`, size)
+			}
+			key, err := generateSymmetricKey("HMAC", size)
+			if err != nil {
+				return err
+			}
+			return writeSymmetricKey(cmd, keyFilename, key, encoding)
+		},
+	}
+
+	generateCmd.Flags().StringVarP(&keyFilename, FlagNameKey, "k", "-",
+		"file to write the secret to")
+	generateCmd.Flags().IntVarP(&size, "size", "s", DefaultHMACKeySize,
+		"secret size in bytes, at least 32")
+	generateCmd.Flags().StringVarP(&encoding, FlagNameEncoding, "e", "raw",
+		"secret encoding: "+strings.Join(keyEncodingNames, ", ")+` ("--key" files must be raw)`)
+
+	jwtCmd.AddCommand(generateCmd)
+}
+
+// generateSymmetricKey returns size random bytes. DES keys get odd parity
+// in the low bit of each byte, as the standard defines them, and 3DES keys
+// never repeat a DES key in a way that degrades them to single DES.
+func generateSymmetricKey(cipherName string, size int) ([]byte, error) {
+	key := make([]byte, size)
+	for {
+		if _, err := io.ReadFull(rand.Reader, key); err != nil {
+			return nil, fmt.Errorf("failed to generate %v key: %v", cipherName, err)
+		}
+		if cipherName != CipherNameDES && cipherName != CipherNameTRIPLEDES {
+			return key, nil
+		}
+		for i, b := range key {
+			key[i] = b&0xfe | (^parity(b>>1) & 1)
+		}
+		if cipherName == CipherNameDES || !degenerateTripleDESKey(key) {
+			return key, nil
+		}
+	}
+}
+
+// parity returns 1 if b has an odd number of set bits.
+func parity(b byte) byte {
+	b ^= b >> 4
+	b ^= b >> 2
+	b ^= b >> 1
+	return b & 1
+}
+
+// degenerateTripleDESKey reports whether a 3DES key has K1 == K2 or K2 ==
+// K3, so encryption collapses to single DES, comparing without the parity
+// bits, which DES ignores.
+func degenerateTripleDESKey(key []byte) bool {
+	k := make([]byte, len(key))
+	for i, b := range key {
+		k[i] = b & 0xfe
+	}
+	return bytes.Equal(k[0:8], k[8:16]) || bytes.Equal(k[8:16], k[16:24])
+}
+
+func warnDegenerateTripleDESKey(key []byte) {
+	if len(key) == 24 && degenerateTripleDESKey(key) {
+		log.Printf("WARNING: the %v key has K1 == K2 or K2 == K3, which is no stronger than single DES", CipherNameTRIPLEDES)
+	}
+}
+
+func writeSymmetricKey(cmd *cobra.Command, filename string, key []byte, encoding string) error {
+	var out []byte
+	switch encoding {
+	case "raw":
+		out = key
+	case "hex":
+		out = []byte(hex.EncodeToString(key) + "\n")
+	case "base64":
+		out = []byte(base64.StdEncoding.EncodeToString(key) + "\n")
+	default:
+		return fmt.Errorf("invalid %q flag %q: must be one of %v",
+			"--"+FlagNameEncoding, encoding, strings.Join(keyEncodingNames, ", "))
+	}
+	w := fileWriter(cmd, FilenameDescriptionKey, filename, true, 0400)
+	if _, err := w.Write(out); err != nil {
+		return fmt.Errorf("failed to write key: %v", err)
+	}
+	if closer, ok := w.(io.Closer); ok && !isStd(filename) {
+		if err := closer.Close(); err != nil {
+			return fmt.Errorf("failed to close key file: %v", err)
+		}
+	}
+	return nil
+}
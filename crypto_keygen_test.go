@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestSymmetricGenerate(t *testing.T) {
+	tempDir := t.TempDir()
+	plaintext := []byte("Hello, generated key! 🔐")
+
+	for _, eg := range []struct {
+		args    []string
+		keySize int
+	}{
+		{[]string{"aes", "generate"}, 32},
+		{[]string{"aes", "generate", "--size", "128"}, 16},
+		{[]string{"aes", "generate", "--size", "192"}, 24},
+		{[]string{"des", "generate"}, 8},
+		{[]string{"des3", "generate"}, 24},
+	} {
+		keyFilename := path.Join(tempDir, strings.Join(eg.args, "-")+".key")
+		if _, err := runSymmetricCmd(t, append(eg.args, "--key", keyFilename), nil); err != nil {
+			t.Fatalf("args=%#v: unexpected error: %v", eg.args, err)
+		}
+		info, err := os.Stat(keyFilename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0400 {
+			t.Fatalf("args=%#v: wanted mode 0400, got %v", eg.args, info.Mode().Perm())
+		}
+		if info.Size() != int64(eg.keySize) {
+			t.Fatalf("args=%#v: wanted a %v-byte key, got %v bytes", eg.args, eg.keySize, info.Size())
+		}
+
+		ciphertext, err := runSymmetricCmd(t, []string{eg.args[0], "--key", keyFilename}, plaintext)
+		if err != nil {
+			t.Fatalf("args=%#v: unexpected encryption error: %v", eg.args, err)
+		}
+		decrypted, err := runSymmetricCmd(t, []string{eg.args[0], "--decrypt", "--key", keyFilename}, ciphertext)
+		if err != nil {
+			t.Fatalf("args=%#v: unexpected decryption error: %v", eg.args, err)
+		}
+		if !bytes.Equal(decrypted, plaintext) {
+			t.Fatalf("args=%#v: roundtrip failed: wanted %q, got %q", eg.args, plaintext, decrypted)
+		}
+	}
+}
+
+func TestSymmetricGenerateEncodings(t *testing.T) {
+	for _, eg := range []struct {
+		encoding string
+		decode   func(string) ([]byte, error)
+	}{
+		{"hex", hex.DecodeString},
+		{"base64", base64.StdEncoding.DecodeString},
+	} {
+		out, err := runSymmetricCmd(t, []string{"aes", "generate", "--encoding", eg.encoding}, nil)
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v", eg.encoding, err)
+		}
+		key, err := eg.decode(strings.TrimSuffix(string(out), "\n"))
+		if err != nil || len(key) != 32 {
+			t.Fatalf("%v: wanted a 32-byte key, got %q (%v)", eg.encoding, out, err)
+		}
+	}
+}
+
+func TestTripleDESGenerateParity(t *testing.T) {
+	for range 16 {
+		key, err := generateSymmetricKey(CipherNameTRIPLEDES, 24)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, b := range key {
+			if parity(b) != 1 {
+				t.Fatalf("byte %v of %x has even parity", i, key)
+			}
+		}
+		if degenerateTripleDESKey(key) {
+			t.Fatalf("generated a degenerate key %x", key)
+		}
+	}
+
+	// Keys differing only in parity bits are still degenerate.
+	k1 := mustHex("0123456789abcdef")
+	k2 := mustHex("0023456789abcdee")
+	if !degenerateTripleDESKey(append(append(append([]byte{}, k1...), k2...), mustRand(8)...)) {
+		t.Fatal("wanted K1 == K2 to be degenerate")
+	}
+}
+
+func TestTripleDESDegenerateKeyWarning(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	k1, k3 := mustRand(8), mustRand(8)
+	keyFilename := path.Join(t.TempDir(), "des3.key")
+	mustWrite(t, keyFilename, append(append(append([]byte{}, k1...), k1...), k3...))
+	if _, err := runSymmetricCmd(t, []string{"des3", "--key", keyFilename}, []byte("secret")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "WARNING: the 3DES key has K1 == K2 or K2 == K3") {
+		t.Fatalf("expected a degenerate key warning, got %q", buf.String())
+	}
+}
+
+func TestJWTGenerateSecret(t *testing.T) {
+	keyFilename := path.Join(t.TempDir(), "hmac.key")
+	if _, _, err := runJWTCmd(t, []string{"jwt", "generate-secret", "--key", keyFilename}, ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	key, err := os.ReadFile(keyFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(key) != DefaultHMACKeySize {
+		t.Fatalf("wanted a %v-byte secret, got %v bytes", DefaultHMACKeySize, len(key))
+	}
+
+	token, _, err := runJWTCmd(t, []string{"jwt", "--alg", "HS512", "--key", keyFilename}, `{"sub":"alice"}`)
+	if err != nil {
+		t.Fatalf("unexpected signing error: %v", err)
+	}
+	if _, _, err := runJWTCmd(t, []string{"jwt", "--decrypt", "--alg", "HS512", "--key", keyFilename}, token); err != nil {
+		t.Fatalf("unexpected verification error: %v", err)
+	}
+}
+
+func TestKeyGenerateErrors(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"aes", "generate", "--size", "512"}, `invalid "--size" flag 512: must be one of 128, 192, 256`},
+		{[]string{"aes", "generate", "--encoding", "base58"}, `invalid "--encoding" flag "base58": must be one of raw, hex, base64`},
+		{[]string{"jwt", "generate-secret", "--size", "16"}, `invalid "--size" flag 16: must be at least 32 bytes`},
+	} {
+		_, err := runSymmetricCmd(t, tc.args, nil)
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Fatalf("args=%#v: expected error containing %q, got %v", tc.args, tc.err, err)
+		}
+	}
+}
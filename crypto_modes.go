@@ -16,6 +16,10 @@ const (
 	cryptoModeECB   cryptoMode = "ecb"
 	cryptoModeOFB   cryptoMode = "ofb"
 	cryptoModeGCM   cryptoMode = "gcm"
+
+	cryptoModeGCMStream cryptoMode = "gcm-stream"
+	cryptoModeGCMSIV    cryptoMode = "gcm-siv"
+	cryptoModeSIV       cryptoMode = "siv"
 )
 
 var (
@@ -27,6 +31,9 @@ var (
 		string(cryptoModeECB),
 		string(cryptoModeOFB),
 		string(cryptoModeGCM),
+		string(cryptoModeGCMStream),
+		string(cryptoModeGCMSIV),
+		string(cryptoModeSIV),
 	}
 
 	cryptoModesString = strings.Join(AllCryptoModeStrings, ", ")
@@ -50,3 +57,37 @@ func (e *cryptoMode) Set(v string) error {
 func (e *cryptoMode) Type() string {
 	return "mode"
 }
+
+type paddingScheme string
+
+const (
+	paddingSchemePKCS7 paddingScheme = "pkcs7"
+	paddingSchemeZero  paddingScheme = "zero"
+	paddingSchemeNone  paddingScheme = "none"
+)
+
+var (
+	AllPaddingSchemeStrings = []string{
+		string(paddingSchemePKCS7),
+		string(paddingSchemeZero),
+		string(paddingSchemeNone),
+	}
+
+	paddingSchemesString = strings.Join(AllPaddingSchemeStrings, ", ")
+)
+
+func (p *paddingScheme) String() string {
+	return string(*p)
+}
+
+func (p *paddingScheme) Set(v string) error {
+	if slices.Contains(AllPaddingSchemeStrings, v) {
+		*p = paddingScheme(v)
+		return nil
+	}
+	return errors.New("must be one of " + paddingSchemesString)
+}
+
+func (p *paddingScheme) Type() string {
+	return "padding"
+}
@@ -39,3 +39,25 @@ func TestCryptoModeSet(t *testing.T) {
 		t.Errorf("cryptoMode.Set with invalid value should not modify receiver, got %q", m)
 	}
 }
+
+func TestPaddingSchemeSet(t *testing.T) {
+	for _, s := range AllPaddingSchemeStrings {
+		var p paddingScheme
+		if err := p.Set(s); err != nil {
+			t.Errorf("paddingScheme.Set(%q) returned unexpected error: %v", s, err)
+		}
+		if p.String() != s {
+			t.Errorf("paddingScheme.Set(%q) set value to %q, want %q", s, p.String(), s)
+		}
+	}
+
+	var p paddingScheme = "zero"
+	if err := p.Set("bogus"); err == nil {
+		t.Error("paddingScheme.Set(\"bogus\") expected error, got nil")
+	} else if want := "must be one of " + paddingSchemesString; err.Error() != want {
+		t.Errorf("paddingScheme.Set(\"bogus\") error = %q, want %q", err.Error(), want)
+	}
+	if p != "zero" {
+		t.Errorf("paddingScheme.Set with invalid value should not modify receiver, got %q", p)
+	}
+}
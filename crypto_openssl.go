@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"enc/padding"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	FlagNameOpenSSL    = "openssl"
+	FlagNameOpenSSLKDF = "openssl-kdf"
+	FlagNameKeySize    = "key-size"
+
+	// DefaultOpenSSLIterations is the "openssl enc -pbkdf2" default "-iter".
+	DefaultOpenSSLIterations = 10_000
+)
+
+// The OpenSSL "enc" format is the magic "Salted__", an 8-byte random salt,
+// and the ciphertext. Both the key and the IV are derived from the password
+// and salt, so no IV is stored.
+var opensslMagic = []byte("Salted__")
+
+const opensslSaltSize = 8
+
+type opensslKDF struct {
+	Name string
+	Hash func() hash.Hash
+	// PBKDF2 selects "-pbkdf2 -iter N"; otherwise the legacy single-round
+	// EVP_BytesToKey derivation of "-md <hash>" is used.
+	PBKDF2 bool
+}
+
+var opensslKDFs = map[string]opensslKDF{
+	"pbkdf2": {"pbkdf2", sha256.New, true},
+	"md5":    {"md5", md5.New, false},
+	"sha256": {"sha256", sha256.New, false},
+}
+
+var opensslKDFNames = []string{"pbkdf2", "md5", "sha256"}
+
+// applyOpenSSLDefaults switches the mode and iteration count to what a
+// plain "openssl enc -aes-256-cbc -pbkdf2" uses, unless given explicitly.
+func applyOpenSSLDefaults(cmd *cobra.Command, o *Options) {
+	if !o.OpenSSL {
+		return
+	}
+	if !cmd.Flags().Changed("mode") {
+		o.CryptoMode = cryptoModeCBC
+	}
+	if !cmd.Flags().Changed(FlagNameIterations) {
+		o.Iterations = DefaultOpenSSLIterations
+	}
+}
+
+// aesKeySize returns the AES key size in bytes for the "--key-size" flag.
+func aesKeySize(bits int) (int, error) {
+	switch bits {
+	case 128, 192, 256:
+		return bits / 8, nil
+	}
+	return 0, fmt.Errorf(`invalid "--%v" value %v: must be one of 128, 192, 256`, FlagNameKeySize, bits)
+}
+
+// OpenSSL "enc" compatible encryption.
+func encryptOpenSSL(cmd *cobra.Command, o *Options, cipherName string, cipherFunc func([]byte) (cipher.Block, error), keySize int) error {
+	kdf, err := checkOpenSSLOptions(o)
+	if err != nil {
+		return err
+	}
+	password, err := readPassword(o)
+	if err != nil {
+		return err
+	}
+	salt := make([]byte, opensslSaltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return fmt.Errorf("failed to generate salt: %v", err)
+	}
+	c, iv, err := opensslCipher(kdf, password, salt, o.Iterations, cipherName, cipherFunc, keySize)
+	if err != nil {
+		return err
+	}
+
+	plaintext, err := io.ReadAll(cmd.InOrStdin())
+	if err != nil {
+		return fmt.Errorf("failed to read plaintext: %v", err)
+	}
+	var ciphertext []byte
+	switch o.CryptoMode {
+	case cryptoModeCBC:
+		padded, err := padding.PadPKCS7(plaintext, uint8(c.BlockSize()))
+		if err != nil {
+			return fmt.Errorf("failed to pad plaintext: %v", err)
+		}
+		ciphertext = make([]byte, len(padded))
+		cipher.NewCBCEncrypter(c, iv).CryptBlocks(ciphertext, padded)
+	case cryptoModeCTR:
+		ciphertext = make([]byte, len(plaintext))
+		cipher.NewCTR(c, iv).XORKeyStream(ciphertext, plaintext)
+	}
+
+	output := append(append(append([]byte{}, opensslMagic...), salt...), ciphertext...)
+	if _, err := cmd.OutOrStdout().Write(output); err != nil {
+		return fmt.Errorf("failed to write ciphertext: %v", err)
+	}
+	return nil
+}
+
+// OpenSSL "enc" compatible decryption.
+func decryptOpenSSL(cmd *cobra.Command, o *Options, cipherName string, cipherFunc func([]byte) (cipher.Block, error), keySize int) error {
+	kdf, err := checkOpenSSLOptions(o)
+	if err != nil {
+		return err
+	}
+	password, err := readPassword(o)
+	if err != nil {
+		return err
+	}
+
+	input, err := io.ReadAll(cmd.InOrStdin())
+	if err != nil {
+		return fmt.Errorf("failed to read ciphertext: %v", err)
+	}
+	headerSize := len(opensslMagic) + opensslSaltSize
+	if len(input) < headerSize || !bytes.HasPrefix(input, opensslMagic) {
+		return fmt.Errorf("input is not in OpenSSL format (missing %q header)", opensslMagic)
+	}
+	salt, ciphertext := input[len(opensslMagic):headerSize], input[headerSize:]
+	c, iv, err := opensslCipher(kdf, password, salt, o.Iterations, cipherName, cipherFunc, keySize)
+	if err != nil {
+		return err
+	}
+
+	var plaintext []byte
+	switch o.CryptoMode {
+	case cryptoModeCBC:
+		if len(ciphertext) == 0 || len(ciphertext)%c.BlockSize() != 0 {
+			return fmt.Errorf("%v/decrypt: ciphertext size %vb is not a positive multiple of block size %vb",
+				cipherName, len(ciphertext), c.BlockSize())
+		}
+		padded := make([]byte, len(ciphertext))
+		cipher.NewCBCDecrypter(c, iv).CryptBlocks(padded, ciphertext)
+		plaintext, err = padding.UnpadPKCS7(padded)
+		if err != nil {
+			return fmt.Errorf("failed to remove padding (wrong password, --%v, --%v or --%v?): %v",
+				FlagNameOpenSSLKDF, FlagNameIterations, FlagNameKeySize, err)
+		}
+	case cryptoModeCTR:
+		plaintext = make([]byte, len(ciphertext))
+		cipher.NewCTR(c, iv).XORKeyStream(plaintext, ciphertext)
+	}
+
+	if _, err := cmd.OutOrStdout().Write(plaintext); err != nil {
+		return fmt.Errorf("failed to write plaintext: %v", err)
+	}
+	return nil
+}
+
+func checkOpenSSLOptions(o *Options) (opensslKDF, error) {
+	kdf, ok := opensslKDFs[o.OpenSSLKDF]
+	if !ok {
+		return opensslKDF{}, fmt.Errorf("invalid %q flag %q: must be one of %v",
+			"--"+FlagNameOpenSSLKDF, o.OpenSSLKDF, strings.Join(opensslKDFNames, ", "))
+	}
+	if !usePassword(o) {
+		return opensslKDF{}, fmt.Errorf(`the "--%v" flag requires "--%v" or "--%v"`,
+			FlagNameOpenSSL, FlagNamePasswordFile, FlagNamePasswordEnv)
+	}
+	if o.CryptoMode != cryptoModeCBC && o.CryptoMode != cryptoModeCTR {
+		return opensslKDF{}, fmt.Errorf(`the "--%v" flag only supports %q and %q modes`,
+			FlagNameOpenSSL, cryptoModeCBC, cryptoModeCTR)
+	}
+	if o.InitializationVectorFilename != "" || o.OmitInitializationVector {
+		return opensslKDF{}, fmt.Errorf(`the "--%v" and "--%v" flags are not supported with "--%v": the IV is derived from the password`,
+			FlagNameIV, FlagNameOmitIV, FlagNameOpenSSL)
+	}
+	if o.Padding != "" {
+		return opensslKDF{}, fmt.Errorf(`the "--%v" flag is only supported in %q mode`, FlagNamePadding, cryptoModeECB)
+	}
+	if o.TagFilename != "" {
+		return opensslKDF{}, fmt.Errorf(`the "--%v" flag is only supported in %q mode`, FlagNameTagFile, cryptoModeGCM)
+	}
+	if o.Envelope {
+		return opensslKDF{}, fmt.Errorf(`the "--%v" flag cannot be combined with "--%v"`, FlagNameEnvelope, FlagNameOpenSSL)
+	}
+	if kdf.PBKDF2 && o.Iterations < 1 {
+		return opensslKDF{}, fmt.Errorf(`invalid "--%v" value %v: must be positive`, FlagNameIterations, o.Iterations)
+	}
+	return kdf, nil
+}
+
+// opensslCipher derives the key and IV like "openssl enc" and returns the
+// keyed block cipher along with the IV.
+func opensslCipher(kdf opensslKDF, password string, salt []byte, iterations int, cipherName string, cipherFunc func([]byte) (cipher.Block, error), keySize int) (cipher.Block, []byte, error) {
+	// All supported ciphers are AES, whose IV is one 16-byte block.
+	const ivSize = 16
+	var keyIV []byte
+	if kdf.PBKDF2 {
+		var err error
+		keyIV, err = pbkdf2.Key(kdf.Hash, password, salt, iterations, keySize+ivSize)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to derive key: %v", err)
+		}
+	} else {
+		keyIV = evpBytesToKey(kdf.Hash, []byte(password), salt, keySize+ivSize)
+	}
+	c, err := cipherFunc(keyIV[:keySize])
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create %v cipher: %v", cipherName, err)
+	}
+	return c, keyIV[keySize:], nil
+}
+
+// evpBytesToKey is OpenSSL's legacy EVP_BytesToKey with an iteration count of
+// one: D_1 = H(password || salt), D_i = H(D_i-1 || password || salt), and the
+// concatenation D_1 || D_2 || ... is truncated to n bytes.
+func evpBytesToKey(newHash func() hash.Hash, password, salt []byte, n int) []byte {
+	var out, prev []byte
+	for len(out) < n {
+		h := newHash()
+		h.Write(prev)
+		h.Write(password)
+		h.Write(salt)
+		prev = h.Sum(nil)
+		out = append(out, prev...)
+	}
+	return out[:n]
+}
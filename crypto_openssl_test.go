@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+// Ciphertexts produced by OpenSSL 3.0 with
+// "printf 'Hello, OpenSSL! 🔐\n' | openssl enc -e <flags> -pass pass:hunter2".
+func TestOpenSSLDecryptKnownOutputs(t *testing.T) {
+	t.Setenv("ENC_TEST_PASSWORD", "hunter2")
+	message := []byte("Hello, OpenSSL! 🔐\n")
+
+	for _, eg := range []struct {
+		opensslFlags string
+		args         []string
+		ciphertext   string
+	}{
+		{"-aes-256-cbc -pbkdf2", nil,
+			"U2FsdGVkX1/8NltNmBM+1n9oy+Jhmvmz942gO4jLh7lz+AVkf3LfbxIBr0cTOrNk"},
+		{"-aes-128-cbc -pbkdf2 -iter 1000", []string{"--key-size", "128", "--iterations", "1000"},
+			"U2FsdGVkX1/vyuSaMsp9oDBqBLe3l2v2tUOIAuV/t3rrUvtzgEbiLgX6LLRAsGjq"},
+		{"-aes-192-ctr -pbkdf2 -iter 2000", []string{"--key-size", "192", "--iterations", "2000", "--mode", "ctr"},
+			"U2FsdGVkX1+v3qvtISzgYZFOQU1FjBI3i76aF8owigFlY1+4WA=="},
+		{"-aes-256-cbc -md md5", []string{"--openssl-kdf", "md5"},
+			"U2FsdGVkX18SX/tj9zDPkzo0/qCEhA2WCLgbLVf0lWToH3vfRRP5ms1igQfJMfJR"},
+		{"-aes-128-ctr -md md5", []string{"--openssl-kdf", "md5", "--key-size", "128", "--mode", "ctr"},
+			"U2FsdGVkX1+e5PNb4MQRPnv+QcI+Z3zhKCKRryagOjrVWOQfQA=="},
+		{"-aes-256-cbc -md sha256", []string{"--openssl-kdf", "sha256"},
+			"U2FsdGVkX1/8QvzzkwJcVmYadJWrnWLCCb1OByVPC6mPq5aU82jyfYQZNE8pJcRz"},
+	} {
+		ciphertext, err := base64.StdEncoding.DecodeString(eg.ciphertext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		args := append([]string{"aes", "--decrypt", "--openssl", "--password-env", "ENC_TEST_PASSWORD"}, eg.args...)
+		plaintext, err := runSymmetricCmd(t, args, ciphertext)
+		if err != nil {
+			t.Fatalf("openssl %v: unexpected decryption error: %v", eg.opensslFlags, err)
+		}
+		if !bytes.Equal(plaintext, message) {
+			t.Fatalf("openssl %v: wanted %q, got %q", eg.opensslFlags, message, plaintext)
+		}
+
+		// Encrypting with the same flags must round-trip.
+		encryptArgs := append([]string{"aes", "--openssl", "--password-env", "ENC_TEST_PASSWORD"}, eg.args...)
+		ciphertext, err = runSymmetricCmd(t, encryptArgs, message)
+		if err != nil {
+			t.Fatalf("openssl %v: unexpected encryption error: %v", eg.opensslFlags, err)
+		}
+		if !bytes.HasPrefix(ciphertext, []byte("Salted__")) {
+			t.Fatalf("openssl %v: ciphertext is missing the Salted__ header", eg.opensslFlags)
+		}
+		plaintext, err = runSymmetricCmd(t, args, ciphertext)
+		if err != nil {
+			t.Fatalf("openssl %v: unexpected roundtrip decryption error: %v", eg.opensslFlags, err)
+		}
+		if !bytes.Equal(plaintext, message) {
+			t.Fatalf("openssl %v: roundtrip wanted %q, got %q", eg.opensslFlags, message, plaintext)
+		}
+	}
+}
+
+func TestOpenSSLErrors(t *testing.T) {
+	t.Setenv("ENC_TEST_PASSWORD", "hunter2")
+	for _, eg := range []struct {
+		args  []string
+		input []byte
+		err   string
+	}{
+		{[]string{"aes", "--openssl"}, nil,
+			`the "--openssl" flag requires "--password-file" or "--password-env"`},
+		{[]string{"aes", "--openssl", "--password-env", "ENC_TEST_PASSWORD", "--mode", "gcm"}, nil,
+			`the "--openssl" flag only supports "cbc" and "ctr" modes`},
+		{[]string{"aes", "--openssl", "--password-env", "ENC_TEST_PASSWORD", "--omit-iv"}, nil,
+			`the IV is derived from the password`},
+		{[]string{"aes", "--openssl", "--password-env", "ENC_TEST_PASSWORD", "--openssl-kdf", "sha1"}, nil,
+			`invalid "--openssl-kdf" flag "sha1"`},
+		{[]string{"aes", "--openssl", "--password-env", "ENC_TEST_PASSWORD", "--key-size", "512"}, nil,
+			`invalid "--key-size" value 512`},
+		{[]string{"aes", "--decrypt", "--openssl", "--password-env", "ENC_TEST_PASSWORD"}, []byte("Unsalted ciphertext"),
+			`input is not in OpenSSL format`},
+		{[]string{"aes", "--decrypt", "--openssl", "--password-env", "ENC_TEST_PASSWORD"}, []byte("Salted__12345678abc"),
+			`is not a positive multiple of block size`},
+	} {
+		_, err := runSymmetricCmd(t, eg.args, eg.input)
+		if err == nil {
+			t.Fatalf("args=%#v: expected an error, got nil", eg.args)
+		}
+		if !strings.Contains(err.Error(), eg.err) {
+			t.Fatalf("args=%#v: wanted error containing %q, got %q", eg.args, eg.err, err.Error())
+		}
+	}
+}
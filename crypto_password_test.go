@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func runSymmetricCmd(t *testing.T, args []string, input []byte) ([]byte, error) {
+	t.Helper()
+	cmd := newEncCmd(getDefaultOptions())
+	cmd.SetArgs(args)
+	cmd.SetIn(bytes.NewReader(input))
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetErr(new(bytes.Buffer))
+	err := cmd.Execute()
+	return out.Bytes(), err
+}
+
+func TestPasswordRoundTrip(t *testing.T) {
+	passwordFilename := path.Join(t.TempDir(), "password.txt")
+	mustWrite(t, passwordFilename, []byte("correct horse battery staple\n"))
+	t.Setenv("ENC_TEST_PASSWORD", "correct horse battery staple")
+	message := []byte("Hello, password! 🔐")
+
+	for _, args := range [][]string{
+		{"aes", "--password-file", passwordFilename},
+		{"aes", "--password-env", "ENC_TEST_PASSWORD"},
+		{"aes", "--mode", "cbc", "--password-file", passwordFilename},
+		{"aes", "--mode", "gcm-stream", "--password-file", passwordFilename},
+		{"des3", "--password-file", passwordFilename},
+		{"des", "--mode", "ofb", "--password-env", "ENC_TEST_PASSWORD"},
+	} {
+		args = append(args, "--iterations", "1000")
+		ciphertext, err := runSymmetricCmd(t, args, message)
+		if err != nil {
+			t.Fatalf("args=%#v: unexpected encryption error: %v", args, err)
+		}
+		if !bytes.HasPrefix(ciphertext, passwordHeaderMagic) {
+			t.Fatalf("args=%#v: ciphertext is missing the password header", args)
+		}
+
+		// The password file and environment variable hold the same password,
+		// and the iteration count is read back from the header.
+		decryptArgs := []string{args[0], "--decrypt", "--password-env", "ENC_TEST_PASSWORD"}
+		if len(args) > 4 && args[1] == "--mode" {
+			decryptArgs = append(decryptArgs, args[1], args[2])
+		}
+		plaintext, err := runSymmetricCmd(t, decryptArgs, ciphertext)
+		if err != nil {
+			t.Fatalf("args=%#v: unexpected decryption error: %v", decryptArgs, err)
+		}
+		if !bytes.Equal(plaintext, message) {
+			t.Fatalf("args=%#v: roundtrip failed: wanted %q, got %q", args, message, plaintext)
+		}
+	}
+}
+
+func TestPasswordWrongPasswordFails(t *testing.T) {
+	t.Setenv("ENC_TEST_PASSWORD", "right")
+	ciphertext, err := runSymmetricCmd(t,
+		[]string{"aes", "--password-env", "ENC_TEST_PASSWORD", "--iterations", "1000"}, []byte("secret"))
+	if err != nil {
+		t.Fatalf("unexpected encryption error: %v", err)
+	}
+
+	t.Setenv("ENC_TEST_PASSWORD", "wrong")
+	_, err = runSymmetricCmd(t,
+		[]string{"aes", "--decrypt", "--password-env", "ENC_TEST_PASSWORD"}, ciphertext)
+	if err == nil {
+		t.Fatal("expected an authentication error for the wrong password, got nil")
+	}
+	if !strings.Contains(err.Error(), "message authentication failed") {
+		t.Fatalf("expected an authentication error, got %q", err.Error())
+	}
+}
+
+// "--key-size" only applies to password-derived keys: with a raw key it is
+// ignored with a warning, even when invalid, and the key's length decides.
+func TestKeySizeIgnoredWithKey(t *testing.T) {
+	keyFilename := path.Join(t.TempDir(), "aes.key")
+	mustWrite(t, keyFilename, mustRand(32))
+	message := []byte("Hello, AES-256!")
+
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	for _, keySize := range []string{"128", "100"} {
+		logged.Reset()
+		ciphertext, err := runSymmetricCmd(t, []string{"aes", "--key", keyFilename, "--key-size", keySize}, message)
+		if err != nil {
+			t.Fatalf("--key-size=%v: unexpected encryption error: %v", keySize, err)
+		}
+		if !strings.Contains(logged.String(), `WARNING: ignoring irrelevant "--key-size" flag`) {
+			t.Fatalf("--key-size=%v: expected a warning, got %q", keySize, logged.String())
+		}
+		plaintext, err := runSymmetricCmd(t, []string{"aes", "--decrypt", "--key", keyFilename}, ciphertext)
+		if err != nil {
+			t.Fatalf("--key-size=%v: unexpected decryption error: %v", keySize, err)
+		}
+		if !bytes.Equal(plaintext, message) {
+			t.Fatalf("--key-size=%v: wanted %q, got %q", keySize, message, plaintext)
+		}
+	}
+}
+
+func TestPasswordErrors(t *testing.T) {
+	keyFilename := path.Join(t.TempDir(), "aes.key")
+	mustWrite(t, keyFilename, mustRand(32))
+	emptyFilename := path.Join(t.TempDir(), "empty.txt")
+	mustWrite(t, emptyFilename, []byte("\n"))
+	t.Setenv("ENC_TEST_PASSWORD", "secret")
+	t.Setenv("ENC_TEST_EMPTY", "")
+
+	for _, eg := range []struct {
+		args  []string
+		input []byte
+		err   string
+	}{
+		{[]string{"aes", "--password-env", "ENC_TEST_PASSWORD", "--key", keyFilename}, nil,
+			`the "--key" flag cannot be combined with "--password-file" or "--password-env"`},
+		{[]string{"aes", "--password-env", "ENC_TEST_PASSWORD", "--password-file", emptyFilename}, nil,
+			`the "--password-file" and "--password-env" flags are mutually exclusive`},
+		{[]string{"aes", "--password-env", "ENC_TEST_EMPTY"}, nil,
+			`password environment variable "ENC_TEST_EMPTY" is unset or empty`},
+		{[]string{"aes", "--password-file", emptyFilename}, nil,
+			"is empty"},
+		{[]string{"aes", "--password-file", "-"}, nil,
+			`does not support "-"`},
+		{[]string{"aes", "--password-env", "ENC_TEST_PASSWORD", "--key-size", "100"}, nil,
+			`invalid "--key-size" value 100: must be one of 128, 192, 256`},
+		{[]string{"aes", "--password-env", "ENC_TEST_PASSWORD", "--iterations", "0"}, nil,
+			`invalid "--iterations" value 0`},
+		{[]string{"aes", "--password-env", "ENC_TEST_PASSWORD", "--iterations", "6000001"}, nil,
+			`invalid "--iterations" value 6000001: must be in range [1,6000000]`},
+		// A crafted header with 2^32-1 iterations is rejected rather than run.
+		{[]string{"aes", "--decrypt", "--password-env", "ENC_TEST_PASSWORD"},
+			append([]byte("encpw\x01\xff\xff\xff\xff"), mustRand(passwordSaltSize+32)...),
+			"invalid iteration count 4294967295 in password header: must be in range [1,6000000]"},
+		{[]string{"aes", "--decrypt", "--password-env", "ENC_TEST_PASSWORD"}, []byte("not a password header!!!!!!!!"),
+			"input is not password-encrypted"},
+		{[]string{"aes", "--decrypt", "--password-env", "ENC_TEST_PASSWORD"}, []byte("short"),
+			"failed to read password header"},
+	} {
+		_, err := runSymmetricCmd(t, eg.args, eg.input)
+		if err == nil {
+			t.Fatalf("args=%#v: expected an error, got nil", eg.args)
+		}
+		if !strings.Contains(err.Error(), eg.err) {
+			t.Fatalf("args=%#v: wanted error containing %q, got %q", eg.args, eg.err, err.Error())
+		}
+	}
+}
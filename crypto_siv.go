@@ -0,0 +1,383 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// The "gcm-siv" (RFC 8452) and "siv" (RFC 5297) modes are nonce-misuse
+// resistant AEADs: the IV is synthesized from the key, nonce, additional
+// data and plaintext, so repeating a nonce only reveals whether two messages
+// are identical. Both are AES only.
+//
+// "gcm-siv" takes a 12-byte nonce, random by default but accepted from
+// "--iv" on encryption too, and outputs nonce || ciphertext || tag.
+//
+// "siv" is deterministic and takes no nonce at all: the key is two AES keys
+// back to back (32, 48 or 64 bytes), and the output is the 16-byte
+// synthetic IV followed by the ciphertext.
+const (
+	gcmSIVNonceSize = 12
+	gcmSIVTagSize   = 16
+	gcmSIVMaxSize   = 1 << 36
+
+	sivSize = 16
+)
+
+// GCM-SIV mode encryption.
+func encryptGCMSIV(cipherName string, c cipher.Block, plaintext []byte, ciphertextWriter io.Writer, o *Options) error {
+	if err := checkGCMSIV(c, o); err != nil {
+		return err
+	}
+	nonce, err := readOrGenerateIV(gcmSIVNonceSize, o)
+	if err != nil {
+		return err
+	}
+	additionalData, err := readAEADAdditionalData(o)
+	if err != nil {
+		return err
+	}
+	if len(plaintext) > gcmSIVMaxSize || len(additionalData) > gcmSIVMaxSize {
+		return fmt.Errorf("%v/encrypt: plaintext and additional data must each be at most %v bytes", cipherName, gcmSIVMaxSize)
+	}
+
+	authKey, encBlock, err := gcmSIVKeys(c, len(o.KeyBytes), nonce)
+	if err != nil {
+		return err
+	}
+	tag := gcmSIVTag(authKey, encBlock, nonce, plaintext, additionalData)
+	ciphertext := make([]byte, len(plaintext), len(plaintext)+gcmSIVTagSize)
+	gcmSIVCTR(encBlock, tag, ciphertext, plaintext)
+	return writeIVAndCiphertext(nonce, append(ciphertext, tag...), ciphertextWriter, o)
+}
+
+// GCM-SIV mode decryption.
+func decryptGCMSIV(cipherName string, c cipher.Block, ciphertext []byte, plaintextWriter io.Writer, o *Options) error {
+	if err := checkGCMSIV(c, o); err != nil {
+		return err
+	}
+	nonce, ciphertext, err := splitIV(gcmSIVNonceSize, ciphertext, o)
+	if err != nil {
+		return err
+	}
+	if len(ciphertext) < gcmSIVTagSize {
+		return fmt.Errorf("ciphertext too short: %v bytes, need at least %v for the tag", len(ciphertext), gcmSIVTagSize)
+	}
+	additionalData, err := readAEADAdditionalData(o)
+	if err != nil {
+		return err
+	}
+
+	authKey, encBlock, err := gcmSIVKeys(c, len(o.KeyBytes), nonce)
+	if err != nil {
+		return err
+	}
+	ciphertext, tag := ciphertext[:len(ciphertext)-gcmSIVTagSize], ciphertext[len(ciphertext)-gcmSIVTagSize:]
+	plaintext := make([]byte, len(ciphertext))
+	gcmSIVCTR(encBlock, tag, plaintext, ciphertext)
+	if subtle.ConstantTimeCompare(tag, gcmSIVTag(authKey, encBlock, nonce, plaintext, additionalData)) != 1 {
+		return fmt.Errorf("cipher: message authentication failed")
+	}
+	if _, err := plaintextWriter.Write(plaintext); err != nil {
+		return fmt.Errorf("failed to write plaintext: %v", err)
+	}
+	return nil
+}
+
+// checkAESOnlyMode rejects the SIV modes for ciphers other than AES before
+// any key is read, since both are defined only for AES.
+func checkAESOnlyMode(cipherName string, o *Options) error {
+	if cipherName != CipherNameAES && (o.CryptoMode == cryptoModeGCMSIV || o.CryptoMode == cryptoModeSIV) {
+		return fmt.Errorf("mode %q is only supported for aes", o.CryptoMode)
+	}
+	return nil
+}
+
+func checkGCMSIV(c cipher.Block, o *Options) error {
+	if c.BlockSize() != aes.BlockSize {
+		return fmt.Errorf("failed to initialize GCM-SIV AEAD mode: requires 128-bit block cipher")
+	}
+	if len(o.KeyBytes) != 16 && len(o.KeyBytes) != 32 {
+		return fmt.Errorf("invalid key size %v for %q mode: must be 16 or 32 bytes", len(o.KeyBytes), cryptoModeGCMSIV)
+	}
+	return nil
+}
+
+// gcmSIVKeys derives the per-nonce POLYVAL key and encryption cipher from
+// the key-generating cipher c (RFC 8452 section 4).
+func gcmSIVKeys(c cipher.Block, keySize int, nonce []byte) (authKey []byte, encBlock cipher.Block, err error) {
+	derived := make([]byte, 0, 16+keySize)
+	block := make([]byte, aes.BlockSize)
+	copy(block[4:], nonce)
+	for i := uint32(0); len(derived) < 16+keySize; i++ {
+		binary.LittleEndian.PutUint32(block, i)
+		out := make([]byte, aes.BlockSize)
+		c.Encrypt(out, block)
+		derived = append(derived, out[:8]...)
+	}
+	encBlock, err = aes.NewCipher(derived[16:])
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create AES cipher: %v", err)
+	}
+	return derived[:16], encBlock, nil
+}
+
+func gcmSIVTag(authKey []byte, encBlock cipher.Block, nonce, plaintext, additionalData []byte) []byte {
+	var lengths [16]byte
+	binary.LittleEndian.PutUint64(lengths[:8], uint64(len(additionalData))*8)
+	binary.LittleEndian.PutUint64(lengths[8:], uint64(len(plaintext))*8)
+
+	p := newPolyval(authKey)
+	p.update(additionalData)
+	p.update(plaintext)
+	p.update(lengths[:])
+	s := p.sum()
+	subtle.XORBytes(s[:gcmSIVNonceSize], s[:gcmSIVNonceSize], nonce)
+	s[15] &= 0x7f
+	tag := make([]byte, gcmSIVTagSize)
+	encBlock.Encrypt(tag, s[:])
+	return tag
+}
+
+// gcmSIVCTR is the CTR variant of RFC 8452, whose initial counter block is
+// the tag with the top bit set and whose counter is the first 32 bits,
+// little-endian, wrapping around.
+func gcmSIVCTR(b cipher.Block, tag, dst, src []byte) {
+	var counter, keystream [aes.BlockSize]byte
+	copy(counter[:], tag)
+	counter[15] |= 0x80
+	for len(src) > 0 {
+		b.Encrypt(keystream[:], counter[:])
+		n := subtle.XORBytes(dst, src, keystream[:])
+		dst, src = dst[n:], src[n:]
+		binary.LittleEndian.PutUint32(counter[:4], binary.LittleEndian.Uint32(counter[:4])+1)
+	}
+}
+
+// polyval computes POLYVAL (RFC 8452 section 3) over the zero-padded inputs
+// passed to update. Field elements are little-endian: bit i of lo (bit i-64
+// of hi) is the coefficient of x^i.
+type polyval struct {
+	h     fieldElement
+	state fieldElement
+}
+
+type fieldElement struct{ lo, hi uint64 }
+
+func newPolyval(key []byte) *polyval {
+	// POLYVAL multiplies by H·x^-128 at every step, so fold the x^-128 into
+	// the key once: x^-128 = x^127 + x^124 + x^121 + x^114 + 1.
+	xInv128 := fieldElement{lo: 1, hi: 1<<63 | 1<<60 | 1<<57 | 1<<50}
+	return &polyval{h: loadFieldElement(key).mul(xInv128)}
+}
+
+func (p *polyval) update(bs []byte) {
+	for len(bs) > 0 {
+		var block [16]byte
+		n := copy(block[:], bs)
+		bs = bs[n:]
+		x := loadFieldElement(block[:])
+		p.state = fieldElement{p.state.lo ^ x.lo, p.state.hi ^ x.hi}.mul(p.h)
+	}
+}
+
+func (p *polyval) sum() [16]byte {
+	var out [16]byte
+	binary.LittleEndian.PutUint64(out[:8], p.state.lo)
+	binary.LittleEndian.PutUint64(out[8:], p.state.hi)
+	return out
+}
+
+func loadFieldElement(bs []byte) fieldElement {
+	return fieldElement{binary.LittleEndian.Uint64(bs[:8]), binary.LittleEndian.Uint64(bs[8:16])}
+}
+
+// mul returns a·b mod x^128 + x^127 + x^126 + x^121 + 1, by Horner's rule
+// over the bits of b from the highest degree down.
+func (a fieldElement) mul(b fieldElement) fieldElement {
+	var r fieldElement
+	for i := 127; i >= 0; i-- {
+		carry := r.hi >> 63
+		r.hi = r.hi<<1 | r.lo>>63
+		r.lo <<= 1
+		mask := -carry
+		r.hi ^= mask & (1<<63 | 1<<62 | 1<<57)
+		r.lo ^= mask & 1
+
+		word := b.lo
+		if i >= 64 {
+			word = b.hi
+		}
+		bit := -(word >> (uint(i) % 64) & 1)
+		r.lo ^= bit & a.lo
+		r.hi ^= bit & a.hi
+	}
+	return r
+}
+
+// SIV mode encryption.
+func encryptSIV(cipherName string, c cipher.Block, plaintext []byte, ciphertextWriter io.Writer, o *Options) error {
+	ctrBlock, err := checkSIV(c, o)
+	if err != nil {
+		return err
+	}
+	additionalData, err := readAdditionalData(o.AdditionalDataFilename)
+	if err != nil {
+		return err
+	}
+	v := s2v(c, sivComponents(o, additionalData, plaintext)...)
+	output := make([]byte, sivSize+len(plaintext))
+	copy(output, v)
+	cipher.NewCTR(ctrBlock, sivCounter(v)).XORKeyStream(output[sivSize:], plaintext)
+	if _, err := ciphertextWriter.Write(output); err != nil {
+		return fmt.Errorf("failed to write ciphertext: %v", err)
+	}
+	return nil
+}
+
+// SIV mode decryption.
+func decryptSIV(cipherName string, c cipher.Block, ciphertext []byte, plaintextWriter io.Writer, o *Options) error {
+	ctrBlock, err := checkSIV(c, o)
+	if err != nil {
+		return err
+	}
+	if len(ciphertext) < sivSize {
+		return fmt.Errorf("ciphertext too short: %v bytes, need at least %v for the synthetic IV", len(ciphertext), sivSize)
+	}
+	additionalData, err := readAdditionalData(o.AdditionalDataFilename)
+	if err != nil {
+		return err
+	}
+	v, ciphertext := ciphertext[:sivSize], ciphertext[sivSize:]
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCTR(ctrBlock, sivCounter(v)).XORKeyStream(plaintext, ciphertext)
+	if subtle.ConstantTimeCompare(v, s2v(c, sivComponents(o, additionalData, plaintext)...)) != 1 {
+		return fmt.Errorf("cipher: message authentication failed")
+	}
+	if _, err := plaintextWriter.Write(plaintext); err != nil {
+		return fmt.Errorf("failed to write plaintext: %v", err)
+	}
+	return nil
+}
+
+// checkSIV validates the SIV options and returns the CTR cipher, keyed with
+// the second half of the key; c is keyed with the first half and used for
+// S2V.
+func checkSIV(c cipher.Block, o *Options) (cipher.Block, error) {
+	if c.BlockSize() != aes.BlockSize {
+		return nil, fmt.Errorf("failed to initialize SIV AEAD mode: requires 128-bit block cipher")
+	}
+	if o.InitializationVectorFilename != "" || o.OmitInitializationVector {
+		return nil, fmt.Errorf(`the "--%v" and "--%v" flags are not supported in %q mode: it is deterministic and uses no nonce`,
+			FlagNameIV, FlagNameOmitIV, cryptoModeSIV)
+	}
+	ctrBlock, err := aes.NewCipher(o.KeyBytes[len(o.KeyBytes)/2:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AES cipher: %v", err)
+	}
+	return ctrBlock, nil
+}
+
+// sivCipherKey returns the half of an SIV key used to key S2V, the other
+// half keying CTR.
+func sivCipherKey(key []byte) ([]byte, error) {
+	switch len(key) {
+	case 32, 48, 64:
+		return key[:len(key)/2], nil
+	}
+	return nil, fmt.Errorf("invalid key size %v for %q mode: must be 32, 48 or 64 bytes (two AES keys)", len(key), cryptoModeSIV)
+}
+
+// sivComponents returns the S2V input strings: the serialized envelope and
+// the additional data, each only if present, and the plaintext last.
+func sivComponents(o *Options, additionalData, plaintext []byte) [][]byte {
+	var components [][]byte
+	if o.EnvelopeBytes != nil {
+		components = append(components, o.EnvelopeBytes)
+	}
+	if o.AdditionalDataFilename != "" {
+		components = append(components, additionalData)
+	}
+	return append(components, plaintext)
+}
+
+// sivCounter clears the 31st and 63rd bits of the synthetic IV to form the
+// initial counter block, so that CTR implementations with 32- or 64-bit
+// counters interoperate.
+func sivCounter(v []byte) []byte {
+	q := append([]byte{}, v...)
+	q[8] &= 0x7f
+	q[12] &= 0x7f
+	return q
+}
+
+// s2v is the RFC 5297 S2V construction over the final component, which is
+// the plaintext, and any number of preceding associated data components.
+func s2v(c cipher.Block, components ...[]byte) []byte {
+	d := cmac(c, make([]byte, aes.BlockSize))
+	for _, s := range components[:len(components)-1] {
+		d = cmacDouble(d)
+		subtle.XORBytes(d, d, cmac(c, s))
+	}
+	last := components[len(components)-1]
+	var t []byte
+	if len(last) >= aes.BlockSize {
+		t = append([]byte{}, last...)
+		tail := t[len(t)-aes.BlockSize:]
+		subtle.XORBytes(tail, tail, d)
+	} else {
+		t = cmacDouble(d)
+		padded := make([]byte, aes.BlockSize)
+		copy(padded, last)
+		padded[len(last)] = 0x80
+		subtle.XORBytes(t, t, padded)
+	}
+	return cmac(c, t)
+}
+
+// cmac is AES-CMAC (NIST SP 800-38B, RFC 4493) for 128-bit block ciphers.
+func cmac(c cipher.Block, msg []byte) []byte {
+	k1 := make([]byte, aes.BlockSize)
+	c.Encrypt(k1, k1)
+	k1 = cmacDouble(k1)
+	k2 := cmacDouble(k1)
+
+	// All but the last block are chained as in CBC-MAC; the last block is
+	// masked with k1 if complete and padded and masked with k2 otherwise.
+	n := (len(msg) + aes.BlockSize - 1) / aes.BlockSize
+	last := make([]byte, aes.BlockSize)
+	if n > 0 && len(msg)%aes.BlockSize == 0 {
+		subtle.XORBytes(last, msg[(n-1)*aes.BlockSize:], k1)
+	} else {
+		if n == 0 {
+			n = 1
+		}
+		copy(last, msg[(n-1)*aes.BlockSize:])
+		last[len(msg)-(n-1)*aes.BlockSize] = 0x80
+		subtle.XORBytes(last, last, k2)
+	}
+	x := make([]byte, aes.BlockSize)
+	for i := 0; i < n-1; i++ {
+		subtle.XORBytes(x, x, msg[i*aes.BlockSize:(i+1)*aes.BlockSize])
+		c.Encrypt(x, x)
+	}
+	subtle.XORBytes(x, x, last)
+	c.Encrypt(x, x)
+	return x
+}
+
+// cmacDouble multiplies by x in GF(2^128) with the big-endian bit order of
+// CMAC and S2V, reducing by x^128 + x^7 + x^2 + x + 1.
+func cmacDouble(bs []byte) []byte {
+	hi, lo := binary.BigEndian.Uint64(bs[:8]), binary.BigEndian.Uint64(bs[8:])
+	carry := hi >> 63
+	hi, lo = hi<<1|lo>>63, lo<<1^(0x87&-carry)
+	out := make([]byte, 16)
+	binary.BigEndian.PutUint64(out[:8], hi)
+	binary.BigEndian.PutUint64(out[8:], lo)
+	return out
+}
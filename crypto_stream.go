@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// The "gcm-stream" mode splits the plaintext into fixed-size chunks, each
+// sealed separately with AES-GCM, so arbitrarily large inputs can be
+// encrypted and decrypted in constant memory. This is the STREAM construction
+// (Hoang, Reyhanitabar, Rogaway and Vizár, 2015): each chunk's 12-byte nonce is
+//
+//	prefix (7 random bytes) || counter (4 bytes, big-endian) || last (1 byte)
+//
+// where the prefix is generated once per stream and written in front of the
+// first chunk, the counter is the chunk index, and last is 1 for the final
+// chunk and 0 otherwise. Binding the index into each nonce detects reordered
+// or dropped chunks, and the last flag detects truncation at a chunk boundary
+// as well as data appended after the final chunk.
+//
+// Output layout: prefix || chunk_0 || ... || chunk_n, where every chunk but
+// the last holds exactly gcmStreamChunkSize bytes of plaintext plus the GCM
+// tag. The last chunk holds the remaining 0..gcmStreamChunkSize bytes, so the
+// empty input still produces one (empty) final chunk.
+const (
+	gcmStreamChunkSize   = 64 * 1024
+	gcmStreamPrefixSize  = 7
+	gcmStreamCounterSize = 4
+)
+
+// GCM stream mode encryption.
+func encryptGCMStream(cipherName string, c cipher.Block, plaintextReader io.Reader, ciphertextWriter io.Writer, o *Options) error {
+	gcm, err := cipher.NewGCM(c)
+	if err != nil {
+		return fmt.Errorf("failed to initialize GCM AEAD mode: %v", err)
+	}
+	if err := rejectIVFlagsForGCMStream(o); err != nil {
+		return err
+	}
+	additionalData, err := readAEADAdditionalData(o)
+	if err != nil {
+		return err
+	}
+
+	prefix := make([]byte, gcmStreamPrefixSize)
+	if _, err := io.ReadFull(rand.Reader, prefix); err != nil {
+		return fmt.Errorf("failed to generate nonce prefix of size %v: %v", gcmStreamPrefixSize, err)
+	}
+	if _, err := ciphertextWriter.Write(prefix); err != nil {
+		return fmt.Errorf("failed to write nonce prefix: %v", err)
+	}
+
+	r := bufio.NewReaderSize(plaintextReader, gcmStreamChunkSize)
+	chunk := make([]byte, gcmStreamChunkSize)
+	sealed := make([]byte, 0, gcmStreamChunkSize+gcm.Overhead())
+	for counter := uint64(0); ; counter++ {
+		n, last, err := readStreamChunk(r, chunk)
+		if err != nil {
+			return fmt.Errorf("failed to read plaintext: %v", err)
+		}
+		nonce, err := gcmStreamNonce(prefix, counter, last)
+		if err != nil {
+			return err
+		}
+		sealed = gcm.Seal(sealed[:0], nonce, chunk[:n], additionalData)
+		if _, err := ciphertextWriter.Write(sealed); err != nil {
+			return fmt.Errorf("failed to write ciphertext: %v", err)
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+// GCM stream mode decryption. Chunks are authenticated and written one at a
+// time, so on failure the plaintext of earlier chunks has already been
+// written; only a successful exit means the whole stream was authentic.
+func decryptGCMStream(cipherName string, c cipher.Block, ciphertextReader io.Reader, plaintextWriter io.Writer, o *Options) error {
+	gcm, err := cipher.NewGCM(c)
+	if err != nil {
+		return fmt.Errorf("failed to initialize GCM AEAD mode: %v", err)
+	}
+	if err := rejectIVFlagsForGCMStream(o); err != nil {
+		return err
+	}
+	additionalData, err := readAEADAdditionalData(o)
+	if err != nil {
+		return err
+	}
+
+	r := bufio.NewReaderSize(ciphertextReader, gcmStreamChunkSize+gcm.Overhead())
+	prefix := make([]byte, gcmStreamPrefixSize)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return fmt.Errorf("ciphertext too short: need at least %v bytes for the nonce prefix: %v", gcmStreamPrefixSize, err)
+	}
+
+	chunk := make([]byte, gcmStreamChunkSize+gcm.Overhead())
+	plaintext := make([]byte, 0, gcmStreamChunkSize)
+	for counter := uint64(0); ; counter++ {
+		n, last, err := readStreamChunk(r, chunk)
+		if err != nil {
+			return fmt.Errorf("failed to read ciphertext: %v", err)
+		}
+		if n < gcm.Overhead() {
+			return fmt.Errorf("chunk %v: truncated ciphertext (%v bytes, need at least %v for the tag)", counter, n, gcm.Overhead())
+		}
+		nonce, err := gcmStreamNonce(prefix, counter, last)
+		if err != nil {
+			return err
+		}
+		plaintext, err = gcm.Open(plaintext[:0], nonce, chunk[:n], additionalData)
+		if err != nil {
+			if last {
+				return fmt.Errorf("chunk %v: %v (stream truncated or tampered with)", counter, err)
+			}
+			return fmt.Errorf("chunk %v: %v (stream reordered, extended or tampered with)", counter, err)
+		}
+		if _, err := plaintextWriter.Write(plaintext); err != nil {
+			return fmt.Errorf("failed to write plaintext: %v", err)
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+// readStreamChunk fills chunk from r, reporting whether it is the last one:
+// either it is short, or it is full and nothing follows it.
+func readStreamChunk(r *bufio.Reader, chunk []byte) (n int, last bool, err error) {
+	n, err = io.ReadFull(r, chunk)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return n, true, nil
+	} else if err != nil {
+		return n, false, err
+	}
+	if _, err := r.Peek(1); errors.Is(err, io.EOF) {
+		return n, true, nil
+	} else if err != nil {
+		return n, false, err
+	}
+	return n, false, nil
+}
+
+func gcmStreamNonce(prefix []byte, counter uint64, last bool) ([]byte, error) {
+	if counter > math.MaxUint32 {
+		return nil, fmt.Errorf("stream too long: more than %v chunks", uint64(math.MaxUint32)+1)
+	}
+	nonce := make([]byte, gcmStreamPrefixSize+gcmStreamCounterSize+1)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[gcmStreamPrefixSize:], uint32(counter))
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce, nil
+}
+
+// rejectIVFlagsForGCMStream errors out rather than silently ignoring
+// --iv/--omit-iv: the nonce prefix is always random and always prepended.
+func rejectIVFlagsForGCMStream(o *Options) error {
+	if o.InitializationVectorFilename != "" || o.OmitInitializationVector {
+		return fmt.Errorf(`the "--%v" and "--%v" flags are not supported in %q mode: a random nonce prefix is always generated and prepended to the ciphertext`,
+			FlagNameIV, FlagNameOmitIV, cryptoModeGCMStream)
+	}
+	return nil
+}
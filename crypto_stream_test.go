@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"path"
+	"strings"
+	"testing"
+)
+
+func gcmStreamEncrypt(t *testing.T, key, plaintext []byte) []byte {
+	c, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := encryptGCMStream("AES", c, bytes.NewReader(plaintext), &out, &Options{}); err != nil {
+		t.Fatalf("unexpected encryption error: %v", err)
+	}
+	return out.Bytes()
+}
+
+func gcmStreamDecrypt(t *testing.T, key, ciphertext []byte) ([]byte, error) {
+	c, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	err = decryptGCMStream("AES", c, bytes.NewReader(ciphertext), &out, &Options{})
+	return out.Bytes(), err
+}
+
+func TestGCMStreamRoundTrip(t *testing.T) {
+	key := mustRand(32)
+	for _, size := range []int{
+		0, 1,
+		gcmStreamChunkSize - 1, gcmStreamChunkSize, gcmStreamChunkSize + 1,
+		3 * gcmStreamChunkSize, 3*gcmStreamChunkSize + 17,
+	} {
+		plaintext := mustRand(size)
+		ciphertext := gcmStreamEncrypt(t, key, plaintext)
+
+		chunks := size/gcmStreamChunkSize + 1
+		if size > 0 && size%gcmStreamChunkSize == 0 {
+			chunks--
+		}
+		if want := gcmStreamPrefixSize + size + chunks*16; len(ciphertext) != want {
+			t.Fatalf("size %v: expected %v bytes of ciphertext, got %v", size, want, len(ciphertext))
+		}
+
+		decrypted, err := gcmStreamDecrypt(t, key, ciphertext)
+		if err != nil {
+			t.Fatalf("size %v: unexpected decryption error: %v", size, err)
+		}
+		if !bytes.Equal(decrypted, plaintext) {
+			t.Fatalf("size %v: roundtrip failed", size)
+		}
+	}
+}
+
+func TestGCMStreamDetectsTampering(t *testing.T) {
+	key := mustRand(16)
+	sealedChunkSize := gcmStreamChunkSize + 16
+	ciphertext := gcmStreamEncrypt(t, key, mustRand(2*gcmStreamChunkSize+100))
+	prefix := ciphertext[:gcmStreamPrefixSize]
+	chunk0 := ciphertext[gcmStreamPrefixSize : gcmStreamPrefixSize+sealedChunkSize]
+	chunk1 := ciphertext[gcmStreamPrefixSize+sealedChunkSize : gcmStreamPrefixSize+2*sealedChunkSize]
+	chunk2 := ciphertext[gcmStreamPrefixSize+2*sealedChunkSize:]
+
+	concat := func(parts ...[]byte) []byte { return bytes.Join(parts, nil) }
+	flipped := bytes.Clone(ciphertext)
+	flipped[gcmStreamPrefixSize+10] ^= 0x01
+
+	for name, tampered := range map[string][]byte{
+		"truncated at chunk boundary": concat(prefix, chunk0, chunk1),
+		"truncated mid-chunk":         ciphertext[:len(ciphertext)-1],
+		"final chunk dropped":         concat(prefix, chunk0, chunk2),
+		"chunks reordered":            concat(prefix, chunk1, chunk0, chunk2),
+		"chunk appended":              concat(ciphertext, chunk2),
+		"bit flipped":                 flipped,
+		"prefix only":                 prefix,
+		"too short for prefix":        prefix[:3],
+	} {
+		if _, err := gcmStreamDecrypt(t, key, tampered); err == nil {
+			t.Fatalf("%v: expected an error, got nil", name)
+		}
+	}
+}
+
+func TestGCMStreamCommandRoundTrip(t *testing.T) {
+	keyFilename := path.Join(t.TempDir(), "aes.key")
+	mustWrite(t, keyFilename, mustRand(32))
+	adFilename := path.Join(t.TempDir(), "ad.dat")
+	mustWrite(t, adFilename, []byte("context"))
+	message := []byte(strings.Repeat("Hello, stream! ", 10000))
+	args := []string{"aes", "--mode", "gcm-stream", "--key", keyFilename, "--additional-data", adFilename}
+
+	encryptCmd := newEncCmd(getDefaultOptions())
+	encryptCmd.SetArgs(args)
+	encryptCmd.SetIn(bytes.NewReader(message))
+	ciphertext := new(bytes.Buffer)
+	encryptCmd.SetOut(ciphertext)
+	if err := encryptCmd.Execute(); err != nil {
+		t.Fatalf("unexpected encryption error: %v", err)
+	}
+
+	decryptCmd := newEncCmd(getDefaultOptions())
+	decryptCmd.SetArgs(append(args, "--decrypt"))
+	decryptCmd.SetIn(bytes.NewReader(ciphertext.Bytes()))
+	plaintext := new(bytes.Buffer)
+	decryptCmd.SetOut(plaintext)
+	if err := decryptCmd.Execute(); err != nil {
+		t.Fatalf("unexpected decryption error: %v", err)
+	}
+	if !bytes.Equal(plaintext.Bytes(), message) {
+		t.Fatal("roundtrip failed")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"log"
@@ -19,21 +20,27 @@ import (
 var knownErrors = map[string]func(algo, mode string, key, message, iv, ad []byte) error{
 	"aes": func(algo, mode string, key, message, iv, ad []byte) error {
 		switch true {
-		case mode == string(cryptoModeCBC):
-			return fmt.Errorf("mode %q not implemented", string(cryptoModeCBC))
-		case mode == string(cryptoModeCFB):
-			return fmt.Errorf("mode %q not implemented", string(cryptoModeCFB))
-		case mode == string(cryptoModeECB):
-			return fmt.Errorf("mode %q not implemented", string(cryptoModeECB))
-		case mode == string(cryptoModeOFB):
-			return fmt.Errorf("mode %q not implemented", string(cryptoModeOFB))
+		case mode == string(cryptoModeSIV) && !find(len(key), 32, 48, 64): // Two AES keys
+			return fmt.Errorf(`invalid key size %v for "siv" mode: must be 32, 48 or 64 bytes (two AES keys)`, len(key))
+		case mode == string(cryptoModeSIV) && len(iv) > 0:
+			return fmt.Errorf(`the "--iv" and "--omit-iv" flags are not supported in "siv" mode: it is deterministic and uses no nonce`)
+		case mode == string(cryptoModeSIV):
+			return nil
 		case !find(len(key), 16, 24, 32): // Key size must be {16,24,32}
 			return fmt.Errorf("failed to create AES cipher: crypto/aes: invalid key size %v", len(key))
-		case mode == string(cryptoModeBlock) && len(message) != len(key):
-			return fmt.Errorf("AES/encrypt: key size %vb != input size %vb", len(key), len(message))
+		case mode == string(cryptoModeBlock) && len(message) != aes.BlockSize:
+			return fmt.Errorf("AES/encrypt: input size %vb != block size 16b", len(message))
 		case mode == string(cryptoModeGCM) && len(iv) > 0:
-			return fmt.Errorf(`the "--iv" and "--omit-iv" flags are not supported in "gcm" mode: a random nonce is always generated and prepended to the ciphertext`)
-		case mode == string(cryptoModeCTR) && len(iv) > 0 && len(iv) != aes.BlockSize:
+			return fmt.Errorf(`the "--iv" flag is not supported when encrypting in "gcm" mode: a random nonce is always generated (use "--omit-iv" to detach it from the ciphertext)`)
+		case mode == string(cryptoModeGCMStream) && len(iv) > 0:
+			return fmt.Errorf(`the "--iv" and "--omit-iv" flags are not supported in "gcm-stream" mode: a random nonce prefix is always generated and prepended to the ciphertext`)
+		case mode == string(cryptoModeECB) && len(iv) > 0:
+			return fmt.Errorf(`the "--iv" and "--omit-iv" flags are not supported in "ecb" mode: it uses no initialization vector`)
+		case mode == string(cryptoModeGCMSIV) && len(key) == 24:
+			return fmt.Errorf(`invalid key size 24 for "gcm-siv" mode: must be 16 or 32 bytes`)
+		case mode == string(cryptoModeGCMSIV) && len(iv) > 0 && len(iv) != gcmSIVNonceSize:
+			return fmt.Errorf("invalid initialization vector size %v for block size %v", len(iv), gcmSIVNonceSize)
+		case usesIV(mode) && len(iv) > 0 && len(iv) != aes.BlockSize:
 			return fmt.Errorf("invalid initialization vector size %v for block size %v", len(iv), aes.BlockSize)
 		}
 		return nil
@@ -42,27 +49,28 @@ var knownErrors = map[string]func(algo, mode string, key, message, iv, ad []byte
 		switch true {
 		case len(ad) > 0:
 			return fmt.Errorf("unknown flag: --additional-data")
-		case mode == string(cryptoModeCBC):
-			return fmt.Errorf("mode %q not implemented", string(cryptoModeCBC))
-		case mode == string(cryptoModeCFB):
-			return fmt.Errorf("mode %q not implemented", string(cryptoModeCFB))
-		case mode == string(cryptoModeECB):
-			return fmt.Errorf("mode %q not implemented", string(cryptoModeECB))
-		case mode == string(cryptoModeOFB):
-			return fmt.Errorf("mode %q not implemented", string(cryptoModeOFB))
+		case mode == string(cryptoModeGCMSIV) || mode == string(cryptoModeSIV): // Rejected before the key is read
+			return fmt.Errorf("mode %q is only supported for aes", mode)
 		case len(key) != 8: // Key size must be 8
 			return fmt.Errorf("failed to create DES cipher: crypto/des: invalid key size %v", len(key))
-		case mode == string(cryptoModeGCM):
+		case mode == string(cryptoModeGCM) || mode == string(cryptoModeGCMStream):
 			return fmt.Errorf("failed to initialize GCM AEAD mode: cipher: NewGCM requires 128-bit block cipher")
-		case mode == string(cryptoModeBlock) && len(message) != len(key):
-			return fmt.Errorf("DES/encrypt: key size 8b != input size %vb", len(message))
-		case mode == string(cryptoModeCTR) && len(iv) > 0 && len(iv) != len(key):
+		case mode == string(cryptoModeBlock) && len(message) != 8:
+			return fmt.Errorf("DES/encrypt: input size %vb != block size 8b", len(message))
+		case mode == string(cryptoModeECB) && len(iv) > 0:
+			return fmt.Errorf(`the "--iv" and "--omit-iv" flags are not supported in "ecb" mode: it uses no initialization vector`)
+		case usesIV(mode) && len(iv) > 0 && len(iv) != len(key):
 			return fmt.Errorf("invalid initialization vector size %v for block size 8", len(iv))
 		}
 		return nil
 	},
 }
 
+// usesIV reports whether mode takes an initialization vector via "--iv".
+func usesIV(mode string) bool {
+	return find(cryptoMode(mode), cryptoModeCBC, cryptoModeCFB, cryptoModeCTR, cryptoModeOFB)
+}
+
 func TestSymmetricCrypto(t *testing.T) {
 	for _, key := range testKeys {
 		for _, message := range testMessages {
@@ -252,6 +260,313 @@ func TestDecryptGCMAEADShortCiphertext(t *testing.T) {
 	}
 }
 
+// With "--omit-iv" and "--tag-file", GCM output is the bare ciphertext: the
+// nonce is logged and the tag written to a file, and decryption reads both
+// back from "--iv" and "--tag-file".
+func TestGCMDetachedNonceAndTag(t *testing.T) {
+	tempDir := t.TempDir()
+	keyFilename := path.Join(tempDir, "aes.key")
+	mustWrite(t, keyFilename, mustRand(32))
+	message := []byte("Hello, detached GCM! 🔐")
+
+	// Detached tag, nonce still prepended.
+	tagFilename := path.Join(tempDir, "prepended.tag")
+	ciphertext, err := runSymmetricCmd(t, []string{"aes", "--key", keyFilename, "--tag-file", tagFilename}, message)
+	if err != nil {
+		t.Fatalf("unexpected encryption error: %v", err)
+	}
+	if len(ciphertext) != 12+len(message) {
+		t.Fatalf("wanted %v bytes of nonce and ciphertext, got %v", 12+len(message), len(ciphertext))
+	}
+	plaintext, err := runSymmetricCmd(t, []string{"aes", "--decrypt", "--key", keyFilename, "--tag-file", tagFilename}, ciphertext)
+	if err != nil {
+		t.Fatalf("unexpected decryption error: %v", err)
+	}
+	if !bytes.Equal(plaintext, message) {
+		t.Fatalf("roundtrip failed: wanted %q, got %q", message, plaintext)
+	}
+
+	// Detached nonce and tag.
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+	tagFilename = path.Join(tempDir, "detached.tag")
+	ciphertext, err = runSymmetricCmd(t, []string{"aes", "--key", keyFilename, "--omit-iv", "--tag-file", tagFilename}, message)
+	if err != nil {
+		t.Fatalf("unexpected encryption error: %v", err)
+	}
+	if len(ciphertext) != len(message) {
+		t.Fatalf("wanted %v bytes of bare ciphertext, got %v", len(message), len(ciphertext))
+	}
+	_, nonceHex, ok := strings.Cut(strings.TrimSpace(logged.String()), "iv=")
+	if !ok {
+		t.Fatalf("expected the nonce to be logged, got %q", logged.String())
+	}
+	nonceFilename := path.Join(tempDir, "nonce")
+	mustWrite(t, nonceFilename, mustHex(nonceHex))
+	decryptArgs := []string{"aes", "--decrypt", "--key", keyFilename, "--iv", nonceFilename, "--tag-file", tagFilename}
+	plaintext, err = runSymmetricCmd(t, decryptArgs, ciphertext)
+	if err != nil {
+		t.Fatalf("unexpected decryption error: %v", err)
+	}
+	if !bytes.Equal(plaintext, message) {
+		t.Fatalf("roundtrip failed: wanted %q, got %q", message, plaintext)
+	}
+
+	// A tampered tag fails authentication.
+	tag, err := os.ReadFile(tagFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag[0] ^= 0x01
+	mustWrite(t, tagFilename, tag)
+	if _, err := runSymmetricCmd(t, decryptArgs, ciphertext); err == nil ||
+		!strings.Contains(err.Error(), "message authentication failed") {
+		t.Fatalf("expected an authentication error for a tampered tag, got %v", err)
+	}
+}
+
+func TestGCMDetachedErrors(t *testing.T) {
+	tempDir := t.TempDir()
+	keyFilename := path.Join(tempDir, "aes.key")
+	mustWrite(t, keyFilename, mustRand(32))
+	existingFilename := path.Join(tempDir, "existing.tag")
+	mustWrite(t, existingFilename, mustRand(16))
+	shortTagFilename := path.Join(tempDir, "short.tag")
+	mustWrite(t, shortTagFilename, mustRand(8))
+	nonceFilename := path.Join(tempDir, "nonce")
+	mustWrite(t, nonceFilename, mustRand(12))
+
+	for _, tc := range []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"aes", "--key", keyFilename, "--iv", nonceFilename},
+			`the "--iv" flag is not supported when encrypting in "gcm" mode`},
+		{[]string{"aes", "--decrypt", "--key", keyFilename, "--omit-iv"},
+			`the "--omit-iv" flag requires "--iv" when decrypting in "gcm" mode`},
+		{[]string{"aes", "--key", keyFilename, "--tag-file", existingFilename},
+			"failed to open tag file"},
+		{[]string{"aes", "--key", keyFilename, "--tag-file", "-"},
+			`the "--tag-file" flag does not support "-"`},
+		{[]string{"aes", "--decrypt", "--key", keyFilename, "--iv", nonceFilename, "--tag-file", shortTagFilename},
+			"invalid authentication tag size 8, expected 16"},
+		{[]string{"aes", "--mode", "ctr", "--key", keyFilename, "--tag-file", path.Join(tempDir, "ctr.tag")},
+			`the "--tag-file" flag is only supported in "gcm" mode`},
+	} {
+		_, err := runSymmetricCmd(t, tc.args, []byte("0123456789abcdef"))
+		if err == nil {
+			t.Fatalf("args=%#v: expected error containing %q, got nil", tc.args, tc.err)
+		}
+		if !strings.Contains(err.Error(), tc.err) {
+			t.Fatalf("args=%#v: expected error containing %q, got %q", tc.args, tc.err, err.Error())
+		}
+	}
+}
+
+// CBC encryption must match the NIST SP 800-38A F.2.1 vector, followed by a
+// final block holding a full block of PKCS#7 padding.
+func TestEncryptCBCKnownAnswer(t *testing.T) {
+	key := mustHex("2b7e151628aed2a6abf7158809cf4f3c")
+	iv := mustHex("000102030405060708090a0b0c0d0e0f")
+	plaintext := mustHex("6bc1bee22e409f96e93d7e117393172a")
+	expected := mustHex("7649abac8119b246cee98e9b12e9197d")
+
+	c, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ivFilename := path.Join(t.TempDir(), "iv.dat")
+	mustWrite(t, ivFilename, iv)
+
+	var out bytes.Buffer
+	o := &Options{InitializationVectorFilename: ivFilename, OmitInitializationVector: true}
+	if err := encryptCBC("AES", c, plaintext, &out, o); err != nil {
+		t.Fatal(err)
+	}
+	if out.Len() != 2*aes.BlockSize {
+		t.Fatalf("expected %v bytes of ciphertext, got %v", 2*aes.BlockSize, out.Len())
+	}
+	if !bytes.Equal(out.Bytes()[:aes.BlockSize], expected) {
+		t.Fatalf("unexpected first ciphertext block\nwanted %x\nactual %x", expected, out.Bytes()[:aes.BlockSize])
+	}
+}
+
+// The stream modes must match the NIST SP 800-38A F.3.13 (CFB128), F.4.1
+// (OFB) and F.5.1 (CTR) AES-128 vectors, and decrypt them back.
+func TestStreamModesKnownAnswer(t *testing.T) {
+	key := mustHex("2b7e151628aed2a6abf7158809cf4f3c")
+	plaintext := mustHex("6bc1bee22e409f96e93d7e117393172aae2d8a571e03ac9c9eb76fac45af8e51")
+	for _, eg := range []struct {
+		mode     cryptoMode
+		iv       []byte
+		expected []byte
+	}{
+		{cryptoModeCFB, mustHex("000102030405060708090a0b0c0d0e0f"),
+			mustHex("3b3fd92eb72dad20333449f8e83cfb4ac8a64537a0b3a93fcde3cdad9f1ce58b")},
+		{cryptoModeOFB, mustHex("000102030405060708090a0b0c0d0e0f"),
+			mustHex("3b3fd92eb72dad20333449f8e83cfb4a7789508d16918f03f53c52dac54ed825")},
+		{cryptoModeCTR, mustHex("f0f1f2f3f4f5f6f7f8f9fafbfcfdfeff"),
+			mustHex("874d6191b620e3261bef6864990db6ce9806f66b7970fdff8617187bb9fffdff")},
+	} {
+		keyFilename := path.Join(t.TempDir(), "aes.key")
+		mustWrite(t, keyFilename, key)
+		ivFilename := path.Join(t.TempDir(), "iv.dat")
+		mustWrite(t, ivFilename, eg.iv)
+		args := []string{"aes", "--mode", string(eg.mode), "--key", keyFilename, "--iv", ivFilename, "--omit-iv"}
+
+		encryptCmd := newEncCmd(getDefaultOptions())
+		encryptCmd.SetArgs(args)
+		encryptCmd.SetIn(bytes.NewReader(plaintext))
+		ciphertext := new(bytes.Buffer)
+		encryptCmd.SetOut(ciphertext)
+		if err := encryptCmd.Execute(); err != nil {
+			t.Fatalf("mode %v: unexpected encryption error: %v", eg.mode, err)
+		}
+		if !bytes.Equal(ciphertext.Bytes(), eg.expected) {
+			t.Fatalf("mode %v: unexpected ciphertext\nwanted %x\nactual %x", eg.mode, eg.expected, ciphertext.Bytes())
+		}
+
+		decryptCmd := newEncCmd(getDefaultOptions())
+		decryptCmd.SetArgs(append(args, "--decrypt"))
+		decryptCmd.SetIn(bytes.NewReader(eg.expected))
+		decrypted := new(bytes.Buffer)
+		decryptCmd.SetOut(decrypted)
+		if err := decryptCmd.Execute(); err != nil {
+			t.Fatalf("mode %v: unexpected decryption error: %v", eg.mode, err)
+		}
+		if !bytes.Equal(decrypted.Bytes(), plaintext) {
+			t.Fatalf("mode %v: unexpected plaintext\nwanted %x\nactual %x", eg.mode, plaintext, decrypted.Bytes())
+		}
+	}
+}
+
+// ECB encryption with "--padding=none" must match the NIST SP 800-38A F.1.1
+// vector; the other paddings must round-trip unaligned input.
+func TestECBPadding(t *testing.T) {
+	keyFilename := path.Join(t.TempDir(), "aes.key")
+	mustWrite(t, keyFilename, mustHex("2b7e151628aed2a6abf7158809cf4f3c"))
+
+	for _, eg := range []struct {
+		padding  paddingScheme
+		input    []byte
+		expected []byte
+		err      string
+	}{
+		{paddingSchemeNone,
+			mustHex("6bc1bee22e409f96e93d7e117393172aae2d8a571e03ac9c9eb76fac45af8e51"),
+			mustHex("3ad77bb40d7a3660a89ecaf32466ef97f5d3d58503b9699de785895a96fdbaaf"), ""},
+		{paddingSchemeNone, []byte("not aligned"), nil,
+			"AES/encrypt: input size 11b is not a multiple of block size 16b (use --padding=pkcs7 or --padding=zero)"},
+		{paddingSchemePKCS7, []byte("exactly 16 bytes"), nil, ""},
+		{paddingSchemeZero, []byte("not aligned"), nil, ""},
+		{"", []byte("Hello, ECB!"), nil, ""},
+	} {
+		args := []string{"aes", "--mode", "ecb", "--key", keyFilename}
+		if eg.padding != "" {
+			args = append(args, "--padding", string(eg.padding))
+		}
+
+		encryptCmd := newEncCmd(getDefaultOptions())
+		encryptCmd.SetArgs(args)
+		encryptCmd.SetIn(bytes.NewReader(eg.input))
+		ciphertext := new(bytes.Buffer)
+		encryptCmd.SetOut(ciphertext)
+		err := encryptCmd.Execute()
+		if eg.err != "" {
+			if err == nil || err.Error() != eg.err {
+				t.Fatalf("args=%#v\nwanted error %q\nactual %v", args, eg.err, err)
+			}
+			continue
+		} else if err != nil {
+			t.Fatalf("args=%#v: unexpected encryption error: %v", args, err)
+		}
+		if ciphertext.Len()%aes.BlockSize != 0 {
+			t.Fatalf("args=%#v: ciphertext size %v is not block-aligned", args, ciphertext.Len())
+		}
+		if eg.expected != nil && !bytes.Equal(ciphertext.Bytes(), eg.expected) {
+			t.Fatalf("args=%#v: unexpected ciphertext\nwanted %x\nactual %x", args, eg.expected, ciphertext.Bytes())
+		}
+
+		decryptCmd := newEncCmd(getDefaultOptions())
+		decryptCmd.SetArgs(append(args, "--decrypt"))
+		decryptCmd.SetIn(bytes.NewReader(ciphertext.Bytes()))
+		plaintext := new(bytes.Buffer)
+		decryptCmd.SetOut(plaintext)
+		if err := decryptCmd.Execute(); err != nil {
+			t.Fatalf("args=%#v: unexpected decryption error: %v", args, err)
+		}
+		if !bytes.Equal(plaintext.Bytes(), eg.input) {
+			t.Fatalf("args=%#v: roundtrip failed\nwanted %q\nactual %q", args, eg.input, plaintext.Bytes())
+		}
+	}
+}
+
+// The "--padding" flag only applies to ECB mode and must not be silently
+// ignored elsewhere.
+func TestPaddingFlagRejectedOutsideECB(t *testing.T) {
+	keyFilename := path.Join(t.TempDir(), "aes.key")
+	mustWrite(t, keyFilename, mustRand(16))
+
+	for _, mode := range []cryptoMode{cryptoModeCBC, cryptoModeCTR, cryptoModeGCM} {
+		cmd := newEncCmd(getDefaultOptions())
+		cmd.SetArgs([]string{"aes", "--mode", string(mode), "--key", keyFilename, "--padding", "zero"})
+		cmd.SetIn(bytes.NewReader([]byte("secret!")))
+		cmd.SetOut(new(bytes.Buffer))
+		cmd.SetErr(new(bytes.Buffer))
+		err := cmd.Execute()
+		if want := `the "--padding" flag is only supported in "ecb" mode`; err == nil || err.Error() != want {
+			t.Fatalf("mode %v: wanted error %q, got %v", mode, want, err)
+		}
+	}
+}
+
+// Well-formed ciphertext whose plaintext does not end in valid PKCS#7 padding
+// must be rejected rather than returned with the padding bytes still attached.
+func TestDecryptCBCInvalidPaddingFails(t *testing.T) {
+	key := mustRand(32)
+	c, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := mustRand(aes.BlockSize)
+	unpadded := []byte("exactly 16 bytes")
+	ciphertext := make([]byte, len(unpadded))
+	cipher.NewCBCEncrypter(c, iv).CryptBlocks(ciphertext, unpadded)
+
+	var out bytes.Buffer
+	err = decryptCBC("AES", c, append(iv, ciphertext...), &out, &Options{})
+	if err == nil {
+		t.Fatal("expected a padding error, got nil")
+	}
+	if !strings.Contains(err.Error(), "invalid PKCS#7 padding") {
+		t.Fatalf("expected an invalid padding error, got %q", err.Error())
+	}
+	if out.Len() != 0 {
+		t.Fatalf("expected no plaintext written on padding failure, got %q", out.String())
+	}
+}
+
+// Ciphertext that is not a whole number of blocks must return an error rather
+// than panicking inside CryptBlocks.
+func TestDecryptCBCPartialBlockFails(t *testing.T) {
+	key := mustRand(16)
+	c, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ciphertext := range [][]byte{
+		mustRand(aes.BlockSize - 1),
+		mustRand(aes.BlockSize),
+		mustRand(aes.BlockSize + 5),
+	} {
+		var out bytes.Buffer
+		if err := decryptCBC("AES", c, ciphertext, &out, &Options{}); err == nil {
+			t.Fatalf("expected an error for %v byte ciphertext, got nil", len(ciphertext))
+		}
+	}
+}
+
 // Regression test: "--key=-" must not be allowed to fall through to
 // io.ReadAll on a nil reader (a panic); it must fail with a clear error.
 func TestSymmetricCryptoKeyDashRejected(t *testing.T) {
@@ -357,6 +672,14 @@ func mustRand(n int) []byte {
 	return bs
 }
 
+func mustHex(s string) []byte {
+	bs, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return bs
+}
+
 func find[T comparable](needle T, haystack ...T) bool {
 	for _, x := range haystack {
 		if x == needle {
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	FlagNameLength = "length"
+	FlagNameSalt   = "salt"
+	FlagNameInfo   = "info"
+)
+
+type ecdhCurveInfo struct {
+	cmdName string
+	curve   ecdh.Curve
+	aliases []string
+}
+
+var ecdhCurves = []ecdhCurveInfo{
+	{"x25519", ecdh.X25519(), nil},
+	{"p256", ecdh.P256(), []string{"p-256", "ecdh-p256"}},
+	{"p384", ecdh.P384(), []string{"p-384", "ecdh-p384"}},
+}
+
+// addECDHCommands adds an elliptic-curve Diffie-Hellman key agreement
+// command per curve. Keys use the same PEM encodings as Ed25519: PKCS8
+// "PRIVATE KEY" and PKIX "PUBLIC KEY" blocks.
+func addECDHCommands(rootCmd *cobra.Command, _ *Options) {
+	for _, curveInfo := range ecdhCurves {
+		ecdhCmd := &cobra.Command{
+			Use:     curveInfo.cmdName,
+			Short:   fmt.Sprintf("Generate %v keys and derive shared secrets", curveInfo.curve),
+			Args:    cobra.NoArgs,
+			Aliases: curveInfo.aliases,
+		}
+
+		addECDHGenerateCmd(ecdhCmd, curveInfo.curve)
+		addECDHExtractPublicKeyCmd(ecdhCmd, curveInfo.curve)
+		addECDHDeriveCmd(ecdhCmd, curveInfo.curve)
+		rootCmd.AddCommand(ecdhCmd)
+	}
+}
+
+func addECDHGenerateCmd(ecdhCmd *cobra.Command, curve ecdh.Curve) {
+	var privateFilename string
+	var publicFilename string
+
+	generateCmd := &cobra.Command{
+		Use:     "generate",
+		Aliases: []string{"gen"},
+		Short:   fmt.Sprintf("Generate a new %v private key pair", curve),
+		Args:    cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			privateKey, err := curve.GenerateKey(rand.Reader)
+			if err != nil {
+				return fmt.Errorf("failed to generate %v key: %v", curve, err)
+			}
+
+			privateWriter := fileWriter(ecdhCmd, FilenameDescriptionPrivateKey, privateFilename, true, 0400)
+			publicWriter := fileWriter(ecdhCmd, FilenameDescriptionPublicKey, publicFilename, true, 0444)
+
+			privateKeyBytes, err := x509.MarshalPKCS8PrivateKey(privateKey)
+			if err != nil {
+				return fmt.Errorf("failed to marshal private key: %v", err)
+			}
+			if err := pem.Encode(privateWriter, &pem.Block{Type: PrivateKeyPEMType, Bytes: privateKeyBytes}); err != nil {
+				return fmt.Errorf("failed to write private key: %v", err)
+			}
+			return writeECDHPublicKey(publicWriter, privateKey.PublicKey())
+		},
+	}
+
+	generateCmd.Flags().StringVar(&privateFilename, FlagNamePrivateKey, "-",
+		"file from which to read or write the private key")
+
+	generateCmd.Flags().StringVar(&publicFilename, FlagNamePublicKey, "-",
+		"file from which to read or write the public key")
+
+	ecdhCmd.AddCommand(generateCmd)
+}
+
+func addECDHExtractPublicKeyCmd(ecdhCmd *cobra.Command, curve ecdh.Curve) {
+	var privateFilename string
+	var publicFilename string
+
+	extractPublicKeyCmd := &cobra.Command{
+		Use:     "extract",
+		Aliases: []string{"extract-public-key", "extract-public", "epk", "ep", "e"},
+		Short:   "Extract the public key from a given private key",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			privateReader := fileReader(cmd, "private", privateFilename, true)
+			privateKeyBytes, err := io.ReadAll(privateReader)
+			if err != nil {
+				return fmt.Errorf("failed to read private key bytes: %v", err)
+			}
+			privateKey, err := parseECDHPrivateKey(privateKeyBytes, curve)
+			if err != nil {
+				return err
+			}
+			publicWriter := fileWriter(ecdhCmd, FilenameDescriptionPublicKey, publicFilename, true, 0444)
+			return writeECDHPublicKey(publicWriter, privateKey.PublicKey())
+		},
+	}
+
+	extractPublicKeyCmd.Flags().StringVar(&privateFilename, FlagNamePrivateKey, "-",
+		"file from which to read or write the private key")
+
+	extractPublicKeyCmd.Flags().StringVar(&publicFilename, FlagNamePublicKey, "-",
+		"file from which to read or write the public key")
+
+	ecdhCmd.AddCommand(extractPublicKeyCmd)
+}
+
+// addECDHDeriveCmd adds a command that agrees on a shared secret between our
+// private key and a peer's public key, and runs it through HKDF rather than
+// output the raw ECDH result, which is not uniformly random.
+func addECDHDeriveCmd(ecdhCmd *cobra.Command, curve ecdh.Curve) {
+	var privateFilename string
+	var publicFilename string
+	var saltFilename string
+	var info string
+	var hashName string
+	var length int
+
+	deriveCmd := &cobra.Command{
+		Use:   "derive",
+		Short: "Derive a shared secret from our private key and a peer's public key",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			hash, ok := rsaHashAlgorithms[hashName]
+			if !ok {
+				return fmt.Errorf("invalid %q flag %q: must be one of %v",
+					"--"+FlagNameHash, hashName, strings.Join(rsaHashNames, ", "))
+			}
+			if length <= 0 {
+				return fmt.Errorf("invalid %q flag %v: must be positive", "--"+FlagNameLength, length)
+			}
+
+			privateKey, err := readECDHPrivateKey(cmd, privateFilename, curve)
+			if err != nil {
+				return err
+			}
+			publicKey, err := readECDHPublicKey(cmd, publicFilename, curve)
+			if err != nil {
+				return err
+			}
+			salt, err := readOptionalFile(FlagNameSalt, saltFilename)
+			if err != nil {
+				return err
+			}
+
+			sharedSecret, err := privateKey.ECDH(publicKey)
+			if err != nil {
+				return fmt.Errorf("failed to agree on a shared secret: %v", err)
+			}
+			secret, err := hkdf.Key(hash.New, sharedSecret, salt, info, length)
+			if err != nil {
+				return fmt.Errorf("failed to derive %v bytes: %v", length, err)
+			}
+			if _, err := cmd.OutOrStdout().Write(secret); err != nil {
+				return fmt.Errorf("failed to write secret: %v", err)
+			}
+			return nil
+		},
+	}
+
+	deriveCmd.Flags().StringVar(&privateFilename, FlagNamePrivateKey, "",
+		"our private key filename")
+	deriveCmd.Flags().StringVar(&publicFilename, FlagNamePublicKey, "",
+		"the peer's public key filename")
+	deriveCmd.Flags().IntVarP(&length, FlagNameLength, "l", 32,
+		"length of the derived secret in bytes")
+	deriveCmd.Flags().StringVar(&saltFilename, FlagNameSalt, "",
+		"HKDF salt filename (optional)")
+	deriveCmd.Flags().StringVar(&info, FlagNameInfo, "",
+		"HKDF context and application specific info (optional)")
+	deriveCmd.Flags().StringVarP(&hashName, FlagNameHash, "a", "sha256",
+		"HKDF hash algorithm: "+strings.Join(rsaHashNames, ", "))
+
+	ecdhCmd.AddCommand(deriveCmd)
+}
+
+func writeECDHPublicKey(w io.Writer, publicKey *ecdh.PublicKey) error {
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return fmt.Errorf("failed to marshal public key: %v", err)
+	}
+	if err := pem.Encode(w, &pem.Block{Type: PublicKeyPEMType, Bytes: publicKeyBytes}); err != nil {
+		return fmt.Errorf("failed to write public key: %v", err)
+	}
+	return nil
+}
+
+func readECDHPrivateKey(cmd *cobra.Command, filename string, curve ecdh.Curve) (*ecdh.PrivateKey, error) {
+	reader := fileReader(cmd, FilenameDescriptionPrivateKey, filename, false)
+	if reader == nil {
+		return nil, fmt.Errorf(`missing or invalid value for %v flag %v=%q`,
+			FilenameDescriptionPrivateKey, "--"+FlagNamePrivateKey, filename)
+	}
+	bs, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key bytes: %v", err)
+	}
+	return parseECDHPrivateKey(bs, curve)
+}
+
+func readECDHPublicKey(cmd *cobra.Command, filename string, curve ecdh.Curve) (*ecdh.PublicKey, error) {
+	reader := fileReader(cmd, FilenameDescriptionPublicKey, filename, false)
+	if reader == nil {
+		return nil, fmt.Errorf(`missing or invalid value for %v flag %v=%q`,
+			FilenameDescriptionPublicKey, "--"+FlagNamePublicKey, filename)
+	}
+	bs, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key bytes: %v", err)
+	}
+	return parseECDHPublicKey(bs, curve)
+}
+
+// parseECDHPrivateKey decodes a PKCS8 PEM private key for ECDH. A nil curve
+// accepts any supported curve.
+func parseECDHPrivateKey(bs []byte, curve ecdh.Curve) (*ecdh.PrivateKey, error) {
+	block, _ := pem.Decode(bs)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode private key PEM")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %v", err)
+	}
+	var privateKey *ecdh.PrivateKey
+	switch key := parsed.(type) {
+	case *ecdh.PrivateKey:
+		privateKey = key
+	case *ecdsa.PrivateKey:
+		if privateKey, err = key.ECDH(); err != nil {
+			return nil, fmt.Errorf("unsupported private key: %v", err)
+		}
+	default:
+		return nil, fmt.Errorf("private key is not an ECDH key")
+	}
+	if curve != nil && privateKey.Curve() != curve {
+		return nil, fmt.Errorf("private key is on curve %v, expected %v", privateKey.Curve(), curve)
+	}
+	return privateKey, nil
+}
+
+// parseECDHPublicKey decodes a PKIX PEM public key for ECDH. A nil curve
+// accepts any supported curve.
+func parseECDHPublicKey(bs []byte, curve ecdh.Curve) (*ecdh.PublicKey, error) {
+	block, _ := pem.Decode(bs)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode public key PEM")
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %v", err)
+	}
+	var publicKey *ecdh.PublicKey
+	switch key := parsed.(type) {
+	case *ecdh.PublicKey:
+		publicKey = key
+	case *ecdsa.PublicKey:
+		if publicKey, err = key.ECDH(); err != nil {
+			return nil, fmt.Errorf("unsupported public key: %v", err)
+		}
+	default:
+		return nil, fmt.Errorf("public key is not an ECDH key")
+	}
+	if curve != nil && publicKey.Curve() != curve {
+		return nil, fmt.Errorf("public key is on curve %v, expected %v", publicKey.Curve(), curve)
+	}
+	return publicKey, nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"crypto/ecdh"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func generateECDHKeys(t *testing.T, cmdName, dir, prefix string) (privateKeyFilename, publicKeyFilename string) {
+	t.Helper()
+	privateKeyFilename = path.Join(dir, prefix+"priv.key")
+	publicKeyFilename = path.Join(dir, prefix+"pub.key")
+	if _, _, err := runRSACmd(t,
+		[]string{cmdName, "generate", "--private-key", privateKeyFilename, "--public-key", publicKeyFilename},
+		""); err != nil {
+		t.Fatalf("%v: keygen failed: %v", cmdName, err)
+	}
+	return privateKeyFilename, publicKeyFilename
+}
+
+func TestECDHDeriveAgrees(t *testing.T) {
+	tempDir := t.TempDir()
+	saltFilename := path.Join(tempDir, "salt")
+	mustWrite(t, saltFilename, mustRand(16))
+
+	for _, cmdName := range []string{"x25519", "p256", "p384"} {
+		alicePrivate, alicePublic := generateECDHKeys(t, cmdName, tempDir, cmdName+"-alice-")
+		bobPrivate, bobPublic := generateECDHKeys(t, cmdName, tempDir, cmdName+"-bob-")
+
+		flags := []string{"--length", "48", "--salt", saltFilename, "--info", "enc test"}
+		aliceSecret, _, err := runRSACmd(t,
+			append([]string{cmdName, "derive", "--private-key", alicePrivate, "--public-key", bobPublic}, flags...), "")
+		if err != nil {
+			t.Fatalf("%v: derive failed: %v", cmdName, err)
+		}
+		bobSecret, _, err := runRSACmd(t,
+			append([]string{cmdName, "derive", "--private-key", bobPrivate, "--public-key", alicePublic}, flags...), "")
+		if err != nil {
+			t.Fatalf("%v: derive failed: %v", cmdName, err)
+		}
+		if len(aliceSecret) != 48 || aliceSecret != bobSecret {
+			t.Fatalf("%v: wanted equal 48-byte secrets, got %x and %x", cmdName, aliceSecret, bobSecret)
+		}
+
+		// Different info derives a different secret.
+		otherSecret, _, err := runRSACmd(t,
+			[]string{cmdName, "derive", "--private-key", alicePrivate, "--public-key", bobPublic, "--info", "other"}, "")
+		if err != nil {
+			t.Fatalf("%v: derive failed: %v", cmdName, err)
+		}
+		if otherSecret == aliceSecret[:32] {
+			t.Fatalf("%v: expected a different secret for different info", cmdName)
+		}
+
+		// The extracted public key matches the generated one.
+		extracted, _, err := runRSACmd(t, []string{cmdName, "extract", "--private-key", alicePrivate}, "")
+		if err != nil {
+			t.Fatalf("%v: extract failed: %v", cmdName, err)
+		}
+		generated, err := os.ReadFile(alicePublic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if extracted != string(generated) {
+			t.Fatalf("%v: extracted public key differs from the generated one", cmdName)
+		}
+	}
+}
+
+// The shared secret must match RFC 7748 section 6.1, run through HKDF-SHA256.
+func TestX25519DeriveKnownAnswer(t *testing.T) {
+	tempDir := t.TempDir()
+	privateKey, err := ecdh.X25519().NewPrivateKey(mustHex("77076d0a7318a57d3c16c17251b26645df4c2f87ebc0992ab177fba51db92c2a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKeyBytes, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKeyFilename := path.Join(tempDir, "priv.key")
+	mustWrite(t, privateKeyFilename, pem.EncodeToMemory(&pem.Block{Type: PrivateKeyPEMType, Bytes: privateKeyBytes}))
+
+	publicKey, err := ecdh.X25519().NewPublicKey(mustHex("de9edb7d7b7dc1b4d35b61c2ece435373f8343c85b78674dadfc7e146f882b4f"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKeyFilename := path.Join(tempDir, "pub.key")
+	mustWrite(t, publicKeyFilename, pem.EncodeToMemory(&pem.Block{Type: PublicKeyPEMType, Bytes: publicKeyBytes}))
+
+	saltFilename := path.Join(tempDir, "salt")
+	mustWrite(t, saltFilename, []byte("salt"))
+
+	secret, _, err := runRSACmd(t, []string{"x25519", "derive", "--private-key", privateKeyFilename,
+		"--public-key", publicKeyFilename, "--length", "40", "--salt", saltFilename, "--info", "enc test"}, "")
+	if err != nil {
+		t.Fatalf("derive failed: %v", err)
+	}
+	want := mustHex("ff215fa275e82053718353220ca35077b669884f3384d02ec9db59b08f5ccbd4700fb9cb6d5b098d")
+	if secret != string(want) {
+		t.Fatalf("wanted %x\nactual %x", want, secret)
+	}
+}
+
+func TestECDHDeriveErrors(t *testing.T) {
+	tempDir := t.TempDir()
+	x25519Private, x25519Public := generateECDHKeys(t, "x25519", tempDir, "x25519-")
+	_, p256Public := generateECDHKeys(t, "p256", tempDir, "p256-")
+
+	for _, tc := range []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"x25519", "derive", "--private-key", x25519Private, "--public-key", p256Public},
+			"public key is on curve P-256, expected X25519"},
+		{[]string{"p256", "derive", "--private-key", x25519Private, "--public-key", p256Public},
+			"private key is on curve X25519, expected P-256"},
+		{[]string{"x25519", "derive", "--public-key", x25519Public},
+			`missing or invalid value for private key flag --private-key=""`},
+		{[]string{"x25519", "derive", "--private-key", x25519Private, "--public-key", x25519Public, "--length", "0"},
+			`invalid "--length" flag 0: must be positive`},
+		{[]string{"x25519", "derive", "--private-key", x25519Private, "--public-key", x25519Public, "--length", "10000"},
+			"failed to derive 10000 bytes"},
+		{[]string{"x25519", "derive", "--private-key", x25519Private, "--public-key", x25519Public, "--salt", "-"},
+			`the "--salt" flag does not support "-"`},
+		{[]string{"x25519", "derive", "--private-key", x25519Private, "--public-key", x25519Public, "--hash", "md5"},
+			`invalid "--hash" flag "md5"`},
+	} {
+		_, _, err := runRSACmd(t, tc.args, "")
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Fatalf("args=%#v: expected error containing %q, got %v", tc.args, tc.err, err)
+		}
+	}
+}
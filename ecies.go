@@ -0,0 +1,140 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/spf13/cobra"
+)
+
+// eciesInfo is the HKDF info for the content key, binding it to this scheme.
+const eciesInfo = "enc ecies AES-256-GCM"
+
+// addECIESCommand adds ECIES-style public-key encryption for the X25519,
+// P-256 and P-384 keys of the ECDH commands: every encryption generates an
+// ephemeral key pair on the recipient's curve, agrees on a shared secret with
+// the recipient's public key, and derives an AES-256-GCM key from it with
+// HKDF-SHA256, salted with both public keys. The output is
+//
+//	ephemeral public key || nonce (12 bytes) || ciphertext || tag (16 bytes)
+//
+// where the ephemeral public key is 32 bytes for X25519, and an uncompressed
+// point of 65 or 97 bytes for P-256 or P-384; it is also authenticated as
+// GCM additional data.
+func addECIESCommand(rootCmd *cobra.Command, o *Options) {
+	short := "Encrypt input using an X25519, P-256 or P-384 public key"
+	if o.Decode {
+		short = "Decrypt input using an X25519, P-256 or P-384 private key"
+	}
+
+	eciesCmd := &cobra.Command{
+		Use:   "ecies",
+		Short: short,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if o.Decode {
+				return eciesDecrypt(cmd, o)
+			}
+			return eciesEncrypt(cmd, o)
+		},
+	}
+
+	eciesCmd.Flags().StringVar(&o.PrivateKeyFilename, FlagNamePrivateKey, "",
+		FilenameDescriptionPrivateKey+" filename, for decrypting")
+	eciesCmd.Flags().StringVar(&o.PublicKeyFilename, FlagNamePublicKey, "",
+		FilenameDescriptionPublicKey+" filename, for encrypting")
+	eciesCmd.Flags().StringVarP(&o.KeyFilename, FlagNameKey, "k", "",
+		"public or private key filename, depending on context")
+
+	rootCmd.AddCommand(eciesCmd)
+}
+
+func eciesEncrypt(cmd *cobra.Command, o *Options) error {
+	if o.PrivateKeyFilename != "" {
+		log.Printf("WARNING: ignoring irrelevant %q flag", "--"+FlagNamePrivateKey)
+	}
+	publicKey, err := readECDHPublicKey(cmd, parseKeyFlagFrom(o, FlagNamePublicKey, o.PublicKeyFilename), nil)
+	if err != nil {
+		return err
+	}
+	plaintext, err := io.ReadAll(cmd.InOrStdin())
+	if err != nil {
+		return fmt.Errorf("failed to read plaintext from stdin: %v", err)
+	}
+
+	ephemeralKey, err := publicKey.Curve().GenerateKey(rand.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to generate ephemeral %v key: %v", publicKey.Curve(), err)
+	}
+	sharedSecret, err := ephemeralKey.ECDH(publicKey)
+	if err != nil {
+		return fmt.Errorf("failed to agree on a shared secret: %v", err)
+	}
+	ephemeralPublicKey := ephemeralKey.PublicKey().Bytes()
+	gcm, err := newECIESGCM(sharedSecret, ephemeralPublicKey, publicKey)
+	if err != nil {
+		return err
+	}
+
+	ciphertextWriter := &prefixWriter{cmd.OutOrStdout(), ephemeralPublicKey}
+	return sealAEAD(gcm, plaintext, ephemeralPublicKey, ciphertextWriter)
+}
+
+func eciesDecrypt(cmd *cobra.Command, o *Options) error {
+	if o.PublicKeyFilename != "" {
+		log.Printf("WARNING: ignoring irrelevant %q flag", "--"+FlagNamePublicKey)
+	}
+	privateKey, err := readECDHPrivateKey(cmd, parseKeyFlagFrom(o, FlagNamePrivateKey, o.PrivateKeyFilename), nil)
+	if err != nil {
+		return err
+	}
+	ciphertext, err := io.ReadAll(cmd.InOrStdin())
+	if err != nil {
+		return fmt.Errorf("failed to read ciphertext from stdin: %v", err)
+	}
+
+	// Every public key on a curve has the same size.
+	ephemeralSize := len(privateKey.PublicKey().Bytes())
+	if len(ciphertext) < ephemeralSize {
+		return fmt.Errorf("ciphertext too short: %v bytes, need at least %v for the ephemeral %v public key",
+			len(ciphertext), ephemeralSize, privateKey.Curve())
+	}
+	ephemeralPublicKey := ciphertext[:ephemeralSize]
+	ephemeralKey, err := privateKey.Curve().NewPublicKey(ephemeralPublicKey)
+	if err != nil {
+		return fmt.Errorf("invalid ephemeral public key: %v", err)
+	}
+	sharedSecret, err := privateKey.ECDH(ephemeralKey)
+	if err != nil {
+		return fmt.Errorf("failed to agree on a shared secret: %v", err)
+	}
+	gcm, err := newECIESGCM(sharedSecret, ephemeralPublicKey, privateKey.PublicKey())
+	if err != nil {
+		return err
+	}
+	return openAEAD(gcm, ciphertext[ephemeralSize:], ephemeralPublicKey, cmd.OutOrStdout())
+}
+
+func newECIESGCM(sharedSecret, ephemeralPublicKey []byte, recipientKey *ecdh.PublicKey) (cipher.AEAD, error) {
+	salt := append(append([]byte{}, ephemeralPublicKey...), recipientKey.Bytes()...)
+	key, err := hkdf.Key(sha256.New, sharedSecret, salt, eciesInfo, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive content key: %v", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AES cipher: %v", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize GCM AEAD mode: %v", err)
+	}
+	return gcm, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestECIESEndToEnd(t *testing.T) {
+	tempDir := t.TempDir()
+	plaintext := "This is a test of ECIES encryption.\n"
+
+	for _, eg := range []struct {
+		cmdName       string
+		ephemeralSize int
+	}{
+		{"x25519", 32},
+		{"p256", 65},
+		{"p384", 97},
+	} {
+		privateKeyFilename, publicKeyFilename := generateECDHKeys(t, eg.cmdName, tempDir, eg.cmdName+"-")
+		otherPrivateKeyFilename, _ := generateECDHKeys(t, eg.cmdName, tempDir, eg.cmdName+"-other-")
+
+		ciphertext, _, err := runRSACmd(t, []string{"ecies", "--public-key", publicKeyFilename}, plaintext)
+		if err != nil {
+			t.Fatalf("%v: unexpected encryption error: %v", eg.cmdName, err)
+		}
+		if want := eg.ephemeralSize + 12 + len(plaintext) + 16; len(ciphertext) != want {
+			t.Fatalf("%v: wanted %v bytes of ephemeral key, nonce, ciphertext and tag, got %v", eg.cmdName, want, len(ciphertext))
+		}
+
+		decrypted, _, err := runRSACmd(t, []string{"ecies", "--decrypt", "--key", privateKeyFilename}, ciphertext)
+		if err != nil {
+			t.Fatalf("%v: unexpected decryption error: %v", eg.cmdName, err)
+		}
+		if decrypted != plaintext {
+			t.Fatalf("%v: roundtrip failed: wanted %q, got %q", eg.cmdName, plaintext, decrypted)
+		}
+
+		// Another key, or any change to the ephemeral public key or the
+		// payload, fails authentication.
+		_, _, err = runRSACmd(t, []string{"ecies", "--decrypt", "--private-key", otherPrivateKeyFilename}, ciphertext)
+		if err == nil || !strings.Contains(err.Error(), "message authentication failed") {
+			t.Fatalf("%v: expected an authentication error for the wrong key, got %v", eg.cmdName, err)
+		}
+		for _, offset := range []int{1, len(ciphertext) - 1} {
+			tampered := []byte(ciphertext)
+			tampered[offset] ^= 0x01
+			if _, _, err := runRSACmd(t, []string{"ecies", "--decrypt", "--private-key", privateKeyFilename}, string(tampered)); err == nil {
+				t.Fatalf("%v: expected an error for ciphertext tampered at offset %v, got nil", eg.cmdName, offset)
+			}
+		}
+	}
+}
+
+func TestECIESErrors(t *testing.T) {
+	tempDir := t.TempDir()
+	x25519Private, _ := generateECDHKeys(t, "x25519", tempDir, "x25519-")
+	ed25519Public := path.Join(tempDir, "ed25519.pub")
+	if _, _, err := runRSACmd(t, []string{"ed25519", "generate", "--private-key", path.Join(tempDir, "ed25519.key"),
+		"--public-key", ed25519Public}, ""); err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+
+	for _, tc := range []struct {
+		args  []string
+		input string
+		err   string
+	}{
+		{[]string{"ecies"}, "", `missing or invalid value for public key flag --public-key=""`},
+		{[]string{"ecies", "--public-key", ed25519Public}, "", "public key is not an ECDH key"},
+		{[]string{"ecies", "--decrypt", "--private-key", x25519Private}, strings.Repeat("x", 31),
+			"ciphertext too short: 31 bytes, need at least 32 for the ephemeral X25519 public key"},
+		{[]string{"ecies", "--decrypt", "--private-key", x25519Private}, strings.Repeat("x", 40),
+			"ciphertext too short: 8 bytes, need at least 28 for the nonce and tag"},
+	} {
+		_, _, err := runRSACmd(t, tc.args, tc.input)
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Fatalf("args=%#v: expected error containing %q, got %v", tc.args, tc.err, err)
+		}
+	}
+}
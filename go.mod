@@ -1,11 +1,21 @@
 module enc
 
-go 1.24
+go 1.24.0
 
 require github.com/spf13/cobra v1.3.0
 
 require github.com/spf13/pflag v1.0.5
 
+require (
+	filippo.io/age v1.3.1
+	filippo.io/hpke v0.4.0 // indirect
+)
+
+require (
+	golang.org/x/crypto v0.48.0
+	golang.org/x/sys v0.41.0 // indirect
+)
+
 require (
 	github.com/btcsuite/btcd/btcutil v1.1.5
 	github.com/inconshreveable/mousetrap v1.0.0 // indirect
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"crypto"
+	_ "crypto/md5"  // Registers crypto.MD5.
+	_ "crypto/sha1" // Registers crypto.SHA1.
+	_ "crypto/sha3" // Registers crypto.SHA3_256 and crypto.SHA3_512.
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	FlagNameFormat = "format"
+	FlagNameCheck  = "check"
+
+	HashFormatRaw = "raw"
+	HashFormatHex = "hex"
+	HashFormatSum = "sum"
+)
+
+// hashAlgorithms extends rsaHashAlgorithms with the SHA-3 hashes and the
+// legacy SHA-1 and MD5, which only remain useful to check existing sums.
+var hashAlgorithms = map[string]crypto.Hash{
+	"sha256":   crypto.SHA256,
+	"sha384":   crypto.SHA384,
+	"sha512":   crypto.SHA512,
+	"sha3-256": crypto.SHA3_256,
+	"sha3-512": crypto.SHA3_512,
+	"sha1":     crypto.SHA1,
+	"md5":      crypto.MD5,
+}
+
+var (
+	hashNames       = []string{"sha256", "sha384", "sha512", "sha3-256", "sha3-512", "sha1", "md5"}
+	hashFormatNames = []string{HashFormatRaw, HashFormatHex, HashFormatSum}
+)
+
+// addHashCommand adds message digests of stdin or files, written raw, as hex
+// or as the lines of "sha256sum" and friends, which "--check" verifies.
+func addHashCommand(rootCmd *cobra.Command) {
+	var hashName string
+	var format string
+	var sumsFilename string
+
+	hashCmd := &cobra.Command{
+		Use:     "hash [files...]",
+		Aliases: []string{"digest"},
+		Short:   "Compute or check message digests of input or files",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			hash, ok := hashAlgorithms[hashName]
+			if !ok {
+				return fmt.Errorf("invalid %q flag %q: must be one of %v",
+					"--"+FlagNameHash, hashName, strings.Join(hashNames, ", "))
+			}
+			if sumsFilename != "" {
+				if len(args) > 0 {
+					return fmt.Errorf(`the "--%v" flag reads the files to check from %q; remove the file arguments`,
+						FlagNameCheck, sumsFilename)
+				}
+				if cmd.Flags().Changed(FlagNameFormat) {
+					log.Printf("WARNING: ignoring irrelevant %q flag with %q", "--"+FlagNameFormat, "--"+FlagNameCheck)
+				}
+				return checkSums(cmd, hashName, hash, sumsFilename)
+			}
+			if format != HashFormatRaw && format != HashFormatHex && format != HashFormatSum {
+				return fmt.Errorf("invalid %q flag %q: must be one of %v",
+					"--"+FlagNameFormat, format, strings.Join(hashFormatNames, ", "))
+			}
+			if len(args) == 0 {
+				args = []string{DefaultStreamName}
+			}
+			for _, filename := range args {
+				digest, err := hashFile(cmd, hash, filename)
+				if err != nil {
+					return err
+				}
+				var line string
+				switch format {
+				case HashFormatRaw:
+					line = string(digest)
+				case HashFormatHex:
+					line = hex.EncodeToString(digest) + "\n"
+				case HashFormatSum:
+					escapedFilename, prefix := escapeSumFilename(filename)
+					line = prefix + hex.EncodeToString(digest) + "  " + escapedFilename + "\n"
+				}
+				if _, err := io.WriteString(cmd.OutOrStdout(), line); err != nil {
+					return fmt.Errorf("failed to write digest: %v", err)
+				}
+			}
+			return nil
+		},
+	}
+
+	hashCmd.Flags().StringVarP(&hashName, FlagNameHash, "a", "sha256",
+		"hash algorithm: "+strings.Join(hashNames, ", "))
+	hashCmd.Flags().StringVarP(&format, FlagNameFormat, "f", HashFormatSum,
+		`output format: raw, hex, sum ("<hex>  <file>" lines, as written by sha256sum)`)
+	hashCmd.Flags().StringVarP(&sumsFilename, FlagNameCheck, "c", "",
+		`check the files listed in this sum file ("-" for stdin) instead`)
+
+	rootCmd.AddCommand(hashCmd)
+}
+
+// hashFile digests the named file, or stdin for "-", without reading it
+// into memory.
+func hashFile(cmd *cobra.Command, hash crypto.Hash, filename string) ([]byte, error) {
+	r := cmd.InOrStdin()
+	if !isStd(filename) {
+		f, err := os.Open(filename)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open file for hashing: %v", err)
+		}
+		defer f.Close()
+		r = f
+	}
+	h := hash.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, fmt.Errorf("failed to read %q: %v", filename, err)
+	}
+	return h.Sum(nil), nil
+}
+
+// checkSums verifies the "<hex>  <file>" lines of a sum file, also accepting
+// the "<hex> *<file>" binary-mode marker and the leading backslash of escaped
+// filenames, and reports each file as "OK" or "FAILED" like "sha256sum
+// --check". As there, improperly formatted lines are counted in a warning and
+// skipped, and are only an error when no line is properly formatted. Any
+// failed check is an error, including a "-" entry when the sum file itself
+// is read from stdin.
+func checkSums(cmd *cobra.Command, hashName string, hash crypto.Hash, sumsFilename string) error {
+	r := cmd.InOrStdin()
+	if !isStd(sumsFilename) {
+		f, err := os.Open(sumsFilename)
+		if err != nil {
+			return fmt.Errorf("failed to open sum file: %v", err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var checked, failed, improper int
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		escaped := strings.HasPrefix(line, "\\")
+		if escaped {
+			line = line[1:]
+		}
+		sum, filename, ok := strings.Cut(line, " ")
+		if ok && (strings.HasPrefix(filename, " ") || strings.HasPrefix(filename, "*")) {
+			filename = filename[1:]
+		} else {
+			ok = false
+		}
+		if ok && escaped {
+			filename, ok = unescapeSumFilename(filename)
+		}
+		want, err := hex.DecodeString(sum)
+		if !ok || err != nil || len(want) != hash.Size() || filename == "" {
+			improper++
+			continue
+		}
+
+		checked++
+		status := "OK"
+		if isStd(filename) && isStd(sumsFilename) {
+			log.Printf("WARNING: can't check %q: stdin is the sum file", filename)
+			status = "FAILED open or read"
+			failed++
+		} else if got, err := hashFile(cmd, hash, filename); err != nil {
+			log.Printf("WARNING: %v", err)
+			status = "FAILED open or read"
+			failed++
+		} else if string(got) != string(want) {
+			status = "FAILED"
+			failed++
+		}
+		escapedFilename, prefix := escapeSumFilename(filename)
+		if _, err := fmt.Fprintf(cmd.OutOrStdout(), "%v%v: %v\n", prefix, escapedFilename, status); err != nil {
+			return fmt.Errorf("failed to write output: %v", err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read sum file: %v", err)
+	}
+	if checked == 0 {
+		return fmt.Errorf("no properly formatted %v checksum lines found in sum file", hashName)
+	}
+	if improper > 0 {
+		log.Printf("WARNING: %v improperly formatted line(s) in sum file", improper)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%v of %v checksum(s) did not match", failed, checked)
+	}
+	return nil
+}
+
+// escapeSumFilename escapes the backslashes and newlines of a filename as
+// sha256sum and friends do, as \\ and \n, and returns the backslash that
+// then marks the start of its line, or "" if it needs no escaping.
+func escapeSumFilename(filename string) (escaped, prefix string) {
+	if !strings.ContainsAny(filename, "\\\n") {
+		return filename, ""
+	}
+	return strings.NewReplacer("\\", "\\\\", "\n", "\\n").Replace(filename), "\\"
+}
+
+// unescapeSumFilename reverses escapeSumFilename, reporting false for any
+// other escape sequence.
+func unescapeSumFilename(filename string) (string, bool) {
+	var b strings.Builder
+	for i := 0; i < len(filename); i++ {
+		if filename[i] != '\\' {
+			b.WriteByte(filename[i])
+			continue
+		}
+		if i++; i == len(filename) {
+			return "", false
+		}
+		switch filename[i] {
+		case '\\':
+			b.WriteByte('\\')
+		case 'n':
+			b.WriteByte('\n')
+		default:
+			return "", false
+		}
+	}
+	return b.String(), true
+}
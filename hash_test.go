@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+// FIPS 180-2 and FIPS 202 "abc" digests, and RFC 1321 for MD5.
+var hashABCDigests = map[string]string{
+	"sha256":   "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+	"sha384":   "cb00753f45a35e8bb5a03d699ac65007272c32ab0eded1631a8b605a43ff5bed8086072ba1e7cc2358baeca134c825a7",
+	"sha512":   "ddaf35a193617abacc417349ae20413112e6fa4e89a97ea20a9eeee64b55d39a2192992a274fc1a836ba3c23a3feebbd454d4423643ce80e2a9ac94fa54ca49f",
+	"sha3-256": "3a985da74fe225b2045c172d6bd390bd855f086e3e9d525b46bfe24511431532",
+	"sha3-512": "b751850b1a57168a5693cd924b6b096e08f621827444f70d884f5d0240d2712e10e116e9192af3c91a7ec57647e3934057340b4cf408d5a56592f8274eec53f0",
+	"sha1":     "a9993e364706816aba3e25717850c26c9cd0d89d",
+	"md5":      "900150983cd24fb0d6963f7d28e17f72",
+}
+
+func TestHashKnownAnswers(t *testing.T) {
+	for _, name := range hashNames {
+		want := hashABCDigests[name]
+		for _, eg := range []struct {
+			format, want string
+		}{
+			{"raw", string(mustHex(want))},
+			{"hex", want + "\n"},
+			{"sum", want + "  -\n"},
+		} {
+			out, _, err := runRSACmd(t, []string{"hash", "--hash", name, "--format", eg.format}, "abc")
+			if err != nil {
+				t.Fatalf("%v/%v: unexpected error: %v", name, eg.format, err)
+			}
+			if out != eg.want {
+				t.Fatalf("%v/%v: wanted %q, got %q", name, eg.format, eg.want, out)
+			}
+		}
+	}
+}
+
+func TestHashFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	aFilename := path.Join(tempDir, "a.txt")
+	mustWrite(t, aFilename, []byte("abc"))
+	bFilename := path.Join(tempDir, "b.txt")
+	mustWrite(t, bFilename, []byte(""))
+
+	out, _, err := runRSACmd(t, []string{"hash", aFilename, "-", bFilename}, "abc")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := hashABCDigests["sha256"] + "  " + aFilename + "\n" +
+		hashABCDigests["sha256"] + "  -\n" +
+		"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855  " + bFilename + "\n"
+	if out != want {
+		t.Fatalf("wanted %q, got %q", want, out)
+	}
+}
+
+func TestHashCheck(t *testing.T) {
+	tempDir := t.TempDir()
+	aFilename := path.Join(tempDir, "a.txt")
+	mustWrite(t, aFilename, []byte("abc"))
+	bFilename := path.Join(tempDir, "b.txt")
+	mustWrite(t, bFilename, []byte("def"))
+
+	sums, _, err := runRSACmd(t, []string{"hash", "--hash", "sha3-256", aFilename, bFilename}, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sumsFilename := path.Join(tempDir, "SHA3SUMS")
+	mustWrite(t, sumsFilename, []byte(sums))
+
+	out, _, err := runRSACmd(t, []string{"hash", "--hash", "sha3-256", "--check", sumsFilename}, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := aFilename + ": OK\n" + bFilename + ": OK\n"; out != want {
+		t.Fatalf("wanted %q, got %q", want, out)
+	}
+
+	// The binary-mode marker and uppercase hex of other tools, from stdin.
+	line := strings.ToUpper(hashABCDigests["md5"]) + " *" + aFilename + "\r\n"
+	if _, _, err := runRSACmd(t, []string{"hash", "--hash", "md5", "--check", "-"}, line); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A changed and a missing file both fail, and are both reported.
+	mustWrite(t, bFilename, []byte("changed"))
+	if err := os.Remove(aFilename); err != nil {
+		t.Fatal(err)
+	}
+	out, _, err = runRSACmd(t, []string{"hash", "--hash", "sha3-256", "--check", sumsFilename}, "")
+	if err == nil || !strings.Contains(err.Error(), "2 of 2 checksum(s) did not match") {
+		t.Fatalf("expected a mismatch error, got %v", err)
+	}
+	if !strings.Contains(out, aFilename+": FAILED open or read\n") || !strings.Contains(out, bFilename+": FAILED\n") {
+		t.Fatalf("expected both files reported as failed, got %q", out)
+	}
+}
+
+// Improperly formatted lines are skipped with a warning, like sha256sum does,
+// and the other lines are still checked.
+func TestHashCheckImproperLines(t *testing.T) {
+	tempDir := t.TempDir()
+	aFilename := path.Join(tempDir, "a.txt")
+	mustWrite(t, aFilename, []byte("abc"))
+	sumsFilename := path.Join(tempDir, "SHA256SUMS")
+	mustWrite(t, sumsFilename, []byte("not a checksum line\n"+
+		hashABCDigests["sha256"]+"  "+aFilename+"\n"+
+		hashABCDigests["sha1"]+"  "+aFilename+"\n"+
+		"\\"+hashABCDigests["sha256"]+"  bad\\escape\n"))
+
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	out, _, err := runRSACmd(t, []string{"hash", "--check", sumsFilename}, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := aFilename + ": OK\n"; out != want {
+		t.Fatalf("wanted %q, got %q", want, out)
+	}
+	if !strings.Contains(logged.String(), "WARNING: 3 improperly formatted line(s) in sum file") {
+		t.Fatalf("expected a warning about 3 lines, got %q", logged.String())
+	}
+
+	// A failed check is still an error.
+	mustWrite(t, aFilename, []byte("changed"))
+	out, _, err = runRSACmd(t, []string{"hash", "--check", sumsFilename}, "")
+	if err == nil || !strings.Contains(err.Error(), "1 of 1 checksum(s) did not match") {
+		t.Fatalf("expected a mismatch error, got %v", err)
+	}
+	if !strings.HasPrefix(out, aFilename+": FAILED\n") {
+		t.Fatalf("expected the file reported as failed, got %q", out)
+	}
+}
+
+// Filenames with backslashes or newlines are escaped like sha256sum does,
+// and their lines marked with a leading backslash.
+func TestHashEscapedFilenames(t *testing.T) {
+	tempDir := t.TempDir()
+	newlineFilename := path.Join(tempDir, "new\nline.txt")
+	mustWrite(t, newlineFilename, []byte("abc"))
+	backslashFilename := path.Join(tempDir, `back\slash.txt`)
+	mustWrite(t, backslashFilename, []byte("abc"))
+
+	sums, _, err := runRSACmd(t, []string{"hash", newlineFilename, backslashFilename}, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `\` + hashABCDigests["sha256"] + "  " + tempDir + `/new\nline.txt` + "\n" +
+		`\` + hashABCDigests["sha256"] + "  " + tempDir + `/back\\slash.txt` + "\n"
+	if sums != want {
+		t.Fatalf("wanted %q, got %q", want, sums)
+	}
+
+	// The report escapes the names the same way.
+	out, _, err := runRSACmd(t, []string{"hash", "--check", "-"}, sums)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := `\` + tempDir + `/new\nline.txt: OK` + "\n" + `\` + tempDir + `/back\\slash.txt: OK` + "\n"; out != want {
+		t.Fatalf("wanted %q, got %q", want, out)
+	}
+}
+
+// A "-" entry can't be checked when stdin is the sum file itself.
+func TestHashCheckStdinEntry(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	empty := "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	out, _, err := runRSACmd(t, []string{"hash", "--check", "-"}, empty+"  -\n")
+	if err == nil || !strings.Contains(err.Error(), "1 of 1 checksum(s) did not match") {
+		t.Fatalf("expected a failed check, got %v", err)
+	}
+	if !strings.HasPrefix(out, "-: FAILED open or read\n") {
+		t.Fatalf("expected the entry reported as failed, got %q", out)
+	}
+	if !strings.Contains(logged.String(), `can't check "-": stdin is the sum file`) {
+		t.Fatalf("expected a warning, got %q", logged.String())
+	}
+}
+
+func TestHashErrors(t *testing.T) {
+	sumsFilename := path.Join(t.TempDir(), "SHA256SUMS")
+	mustWrite(t, sumsFilename, []byte(hashABCDigests["sha1"]+"  a.txt\n"))
+
+	for _, tc := range []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"hash", "--hash", "sha224"},
+			`invalid "--hash" flag "sha224": must be one of sha256, sha384, sha512, sha3-256, sha3-512, sha1, md5`},
+		{[]string{"hash", "--format", "base64"}, `invalid "--format" flag "base64": must be one of raw, hex, sum`},
+		{[]string{"hash", "does-not-exist"}, "failed to open file for hashing"},
+		{[]string{"hash", "--check", sumsFilename, "a.txt"}, "remove the file arguments"},
+		{[]string{"hash", "--check", sumsFilename}, "no properly formatted sha256 checksum lines found"},
+		{[]string{"hash", "--check", "-"}, "no properly formatted sha256 checksum lines found"},
+	} {
+		_, _, err := runRSACmd(t, tc.args, "")
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Fatalf("args=%#v: expected error containing %q, got %v", tc.args, tc.err, err)
+		}
+	}
+}
@@ -131,8 +131,8 @@ func addJWECommand(rootCmd *cobra.Command, o *Options) {
 		"raw symmetric CEK filename (for alg=dir)")
 	cmd.Flags().StringVar(&o.PrivateKeyFilename, FlagNamePrivateKey, "",
 		"private key filename, for decrypting (RSA PKCS1 PEM for alg=RSA-OAEP-256)")
-	cmd.Flags().StringVar(&o.PublicKeyFilename, FlagNamePublicKey, "",
-		"public key filename, for encrypting (RSA PKCS1 PEM for alg=RSA-OAEP-256)")
+	cmd.Flags().StringArrayVar(&o.PublicKeyFilenames, FlagNamePublicKey, nil,
+		"public key filename, for encrypting (RSA PKCS1 PEM for alg=RSA-OAEP-256); repeat to encrypt for several recipients (only RSA recipients are supported)")
 	cmd.Flags().StringVar(&kid, FlagNameKid, "",
 		"key ID to embed in the header; ignored when decrypting")
 	cmd.Flags().BoolVarP(&o.AppendNewline, FlagNameAppendNewline, "n", o.AppendNewline,
@@ -156,15 +156,18 @@ func jweEncryptCmd(cmd *cobra.Command, o *Options, keyAlg jweKeyAlg, encAlg jweE
 		}
 		cek = key
 	case jweKeyAlgFamilyRSA:
-		publicKey, err := readRSAPublicKey(cmd, o)
+		publicKeys, err := readRSAPublicKeys(cmd, o)
 		if err != nil {
 			return err
 		}
+		if len(publicKeys) > 1 {
+			return jweEncryptRecipients(cmd, o, keyAlg, encAlg, kid, publicKeys)
+		}
 		cek = make([]byte, encAlg.KeySize)
 		if _, err := io.ReadFull(rand.Reader, cek); err != nil {
 			return fmt.Errorf("failed to generate CEK: %v", err)
 		}
-		encryptedKey, err = rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, cek, nil)
+		encryptedKey, err = rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKeys[0], cek, nil)
 		if err != nil {
 			return fmt.Errorf("failed to wrap CEK: %v", err)
 		}
@@ -225,6 +228,9 @@ func jweDecryptCmd(cmd *cobra.Command, o *Options, keyAlgName, encAlgName string
 		return fmt.Errorf("failed to read token from input: %v", err)
 	}
 	token := strings.TrimSpace(string(input))
+	if strings.HasPrefix(token, "{") {
+		return jweDecryptRecipients(cmd, o, keyAlgName, encAlgName, []byte(token))
+	}
 	parts := strings.Split(token, ".")
 	if len(parts) != 5 {
 		return fmt.Errorf("invalid JWE: expected 5 dot-separated parts, got %v", len(parts))
@@ -357,7 +363,7 @@ func warnIrrelevantJWEKeyFlags(keyAlg jweKeyAlg, o *Options) {
 		if o.PrivateKeyFilename != "" {
 			log.Printf("WARNING: ignoring irrelevant %q flag for alg=dir", "--"+FlagNamePrivateKey)
 		}
-		if o.PublicKeyFilename != "" {
+		if len(o.PublicKeyFilenames) > 0 {
 			log.Printf("WARNING: ignoring irrelevant %q flag for alg=dir", "--"+FlagNamePublicKey)
 		}
 	case jweKeyAlgFamilyRSA:
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/spf13/cobra"
+)
+
+// A JWE for several recipients can't use the compact serialization, which
+// has room for one encrypted key, so it is written in the general JSON
+// serialization of RFC 7516 section 7.2.1: the CEK is wrapped once per
+// recipient, each in its own "recipients" entry whose unprotected header
+// carries the "alg" and a "kid" set to the RFC 7638 thumbprint of the
+// recipient's public key.
+type jweGeneralJSON struct {
+	Protected  string         `json:"protected"`
+	Recipients []jweRecipient `json:"recipients"`
+	IV         string         `json:"iv"`
+	Ciphertext string         `json:"ciphertext"`
+	Tag        string         `json:"tag"`
+}
+
+type jweRecipient struct {
+	Header struct {
+		Alg string `json:"alg,omitempty"`
+		Kid string `json:"kid,omitempty"`
+	} `json:"header"`
+	EncryptedKey string `json:"encrypted_key"`
+}
+
+func jweEncryptRecipients(cmd *cobra.Command, o *Options, keyAlg jweKeyAlg, encAlg jweEnc, kid string, publicKeys []*rsa.PublicKey) error {
+	if kid != "" {
+		return fmt.Errorf(`the %q flag is not supported with several %q recipients: each recipient's "kid" is its key thumbprint`,
+			"--"+FlagNameKid, "--"+FlagNamePublicKey)
+	}
+
+	cek := make([]byte, encAlg.KeySize)
+	if _, err := io.ReadFull(rand.Reader, cek); err != nil {
+		return fmt.Errorf("failed to generate CEK: %v", err)
+	}
+	var token jweGeneralJSON
+	for i, publicKey := range publicKeys {
+		encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, cek, nil)
+		if err != nil {
+			return fmt.Errorf("failed to wrap CEK for recipient %v: %v", i+1, err)
+		}
+		var recipient jweRecipient
+		recipient.Header.Alg = keyAlg.Name
+		recipient.Header.Kid = base64.RawURLEncoding.EncodeToString(rsaKeyID(publicKey))
+		recipient.EncryptedKey = base64.RawURLEncoding.EncodeToString(encryptedKey)
+		token.Recipients = append(token.Recipients, recipient)
+	}
+
+	headerJSON, err := json.Marshal(map[string]any{"enc": encAlg.Name})
+	if err != nil {
+		return fmt.Errorf("failed to encode header: %v", err)
+	}
+	token.Protected = base64.RawURLEncoding.EncodeToString(headerJSON)
+
+	plaintext, err := io.ReadAll(cmd.InOrStdin())
+	if err != nil {
+		return fmt.Errorf("failed to read plaintext from input: %v", err)
+	}
+	iv := make([]byte, encAlg.IVSize)
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return fmt.Errorf("failed to generate IV: %v", err)
+	}
+	ciphertext, tag, err := jweSealContent(cek, iv, plaintext, []byte(token.Protected))
+	if err != nil {
+		return fmt.Errorf("failed to encrypt content: %v", err)
+	}
+	token.IV = base64.RawURLEncoding.EncodeToString(iv)
+	token.Ciphertext = base64.RawURLEncoding.EncodeToString(ciphertext)
+	token.Tag = base64.RawURLEncoding.EncodeToString(tag)
+
+	tokenJSON, err := json.Marshal(token)
+	if err != nil {
+		return fmt.Errorf("failed to encode token: %v", err)
+	}
+	out := cmd.OutOrStdout()
+	if _, err := out.Write(tokenJSON); err != nil {
+		return fmt.Errorf("failed to write token: %v", err)
+	}
+	if o.AppendNewline {
+		if _, err := io.WriteString(out, "\n"); err != nil {
+			return fmt.Errorf("failed to append trailing newline: %v", err)
+		}
+	}
+	return nil
+}
+
+// jweDecryptRecipients decrypts a general JSON serialization JWE by trying
+// the private key against each recipient in turn, and reports which one
+// matched.
+func jweDecryptRecipients(cmd *cobra.Command, o *Options, keyAlgName, encAlgName string, input []byte) error {
+	var token jweGeneralJSON
+	if err := json.Unmarshal(input, &token); err != nil {
+		return fmt.Errorf("failed to parse JSON serialization: %v", err)
+	}
+	if len(token.Recipients) == 0 {
+		return fmt.Errorf(`invalid JWE JSON serialization: missing "recipients"`)
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(token.Protected)
+	if err != nil {
+		return fmt.Errorf("failed to decode header: %v", err)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Enc string `json:"enc"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return fmt.Errorf("failed to parse header JSON: %v", err)
+	}
+	if header.Enc == "" {
+		return fmt.Errorf(`token header is missing required "enc" field (malformed or non-JWE token)`)
+	}
+	encAlg, err := resolveJWEEnc(encAlgName, header.Enc)
+	if err != nil {
+		return err
+	}
+
+	iv, err := base64.RawURLEncoding.DecodeString(token.IV)
+	if err != nil {
+		return fmt.Errorf("failed to decode IV: %v", err)
+	}
+	ciphertext, err := base64.RawURLEncoding.DecodeString(token.Ciphertext)
+	if err != nil {
+		return fmt.Errorf("failed to decode ciphertext: %v", err)
+	}
+	tag, err := base64.RawURLEncoding.DecodeString(token.Tag)
+	if err != nil {
+		return fmt.Errorf("failed to decode tag: %v", err)
+	}
+
+	warnIrrelevantJWEKeyFlags(jweKeyAlgorithms["RSA-OAEP-256"], o)
+	privateKey, err := readRSAPrivateKey(cmd, o)
+	if err != nil {
+		return err
+	}
+	var cek []byte
+	for i, recipient := range token.Recipients {
+		alg := recipient.Header.Alg
+		if alg == "" {
+			alg = header.Alg
+		}
+		keyAlg, err := resolveJWEKeyAlg(keyAlgName, alg)
+		if err != nil {
+			return fmt.Errorf("recipient %v: %v", i+1, err)
+		}
+		if keyAlg.Family != jweKeyAlgFamilyRSA {
+			return fmt.Errorf("recipient %v: alg %q is not supported in the JSON serialization", i+1, keyAlg.Name)
+		}
+		encryptedKey, err := base64.RawURLEncoding.DecodeString(recipient.EncryptedKey)
+		if err != nil {
+			return fmt.Errorf("recipient %v: failed to decode encrypted key: %v", i+1, err)
+		}
+		cek, err = rsa.DecryptOAEP(sha256.New(), nil, privateKey, encryptedKey, nil)
+		if err == nil {
+			log.Printf("decrypting as recipient %v of %v (kid %q)", i+1, len(token.Recipients), recipient.Header.Kid)
+			break
+		}
+	}
+	if cek == nil {
+		return fmt.Errorf("failed to unwrap CEK: the private key matches none of the %v recipients", len(token.Recipients))
+	}
+	if len(cek) != encAlg.KeySize {
+		return fmt.Errorf("CEK size %v bytes does not match %v requirement of %v bytes", len(cek), encAlg.Name, encAlg.KeySize)
+	}
+
+	plaintext, err := jweOpenContent(cek, iv, ciphertext, tag, []byte(token.Protected))
+	if err != nil {
+		return fmt.Errorf("content decryption failed: %v", err)
+	}
+
+	out := cmd.OutOrStdout()
+	if _, err := out.Write(plaintext); err != nil {
+		return fmt.Errorf("failed to write plaintext: %v", err)
+	}
+	if o.AppendNewline {
+		if _, err := io.WriteString(out, "\n"); err != nil {
+			return fmt.Errorf("failed to append trailing newline: %v", err)
+		}
+	}
+	return nil
+}
@@ -369,6 +369,61 @@ func TestJWEWrongRSAKeyRejected(t *testing.T) {
 	}
 }
 
+func TestJWEMultipleRecipients(t *testing.T) {
+	tempDir := t.TempDir()
+	onePrivateKeyFilename, onePublicKeyFilename := generateJWERSAKeys(t, tempDir, "one-")
+	twoPrivateKeyFilename, twoPublicKeyFilename := generateJWERSAKeys(t, tempDir, "two-")
+	otherPrivateKeyFilename, _ := generateJWERSAKeys(t, tempDir, "other-")
+
+	token, _, err := runJWTCmd(t,
+		[]string{"jwe", "--alg=RSA-OAEP-256", "--public-key", onePublicKeyFilename, "--public-key", twoPublicKeyFilename},
+		"Hello, recipients!")
+	if err != nil {
+		t.Fatalf("encrypt failed: %v", err)
+	}
+	var general struct {
+		Protected  string `json:"protected"`
+		Recipients []struct {
+			Header       map[string]string `json:"header"`
+			EncryptedKey string            `json:"encrypted_key"`
+		} `json:"recipients"`
+	}
+	if err := json.Unmarshal([]byte(token), &general); err != nil {
+		t.Fatalf("expected the general JSON serialization, got %q: %v", token, err)
+	}
+	if len(general.Recipients) != 2 {
+		t.Fatalf("expected 2 recipients, got %v", len(general.Recipients))
+	}
+	for i, recipient := range general.Recipients {
+		if recipient.Header["alg"] != "RSA-OAEP-256" || recipient.Header["kid"] == "" || recipient.EncryptedKey == "" {
+			t.Fatalf("recipient %v: unexpected entry %+v", i+1, recipient)
+		}
+	}
+
+	for _, privateKeyFilename := range []string{onePrivateKeyFilename, twoPrivateKeyFilename} {
+		plaintext, _, err := runJWTCmd(t,
+			[]string{"jwe", "-d", "--alg=RSA-OAEP-256", "--enc=A256GCM", "--private-key", privateKeyFilename}, token)
+		if err != nil {
+			t.Fatalf("decrypt failed: %v", err)
+		}
+		if plaintext != "Hello, recipients!" {
+			t.Fatalf("expected plaintext %q, got %q", "Hello, recipients!", plaintext)
+		}
+	}
+
+	_, _, err = runJWTCmd(t, []string{"jwe", "-d", "--private-key", otherPrivateKeyFilename}, token)
+	if err == nil || !strings.Contains(err.Error(), "matches none of the 2 recipients") {
+		t.Fatalf("expected an unwrap error for a non-recipient, got %v", err)
+	}
+
+	_, _, err = runJWTCmd(t,
+		[]string{"jwe", "--alg=RSA-OAEP-256", "--kid=ops", "--public-key", onePublicKeyFilename, "--public-key", twoPublicKeyFilename},
+		"Hello, recipients!")
+	if err == nil || !strings.Contains(err.Error(), `the "--kid" flag is not supported with several "--public-key" recipients`) {
+		t.Fatalf("expected a --kid error, got %v", err)
+	}
+}
+
 func TestJWEInvalidAlgRejected(t *testing.T) {
 	if _, _, err := runJWTCmd(t, []string{"jwe", "--alg=bogus"}, "hi"); err == nil {
 		t.Fatal("expected error for invalid --alg, got nil")
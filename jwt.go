@@ -128,6 +128,7 @@ func addJWTCommand(rootCmd *cobra.Command, o *Options) {
 		"append a trailing newline to the output")
 
 	addJWTDumpCmd(cmd)
+	addJWTGenerateSecretCmd(cmd)
 
 	rootCmd.AddCommand(cmd)
 }
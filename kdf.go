@@ -0,0 +1,204 @@
+package main
+
+import (
+	"crypto/hkdf"
+	"crypto/pbkdf2"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	FlagNameInfoFile = "info-file"
+	FlagNameExtract  = "extract"
+	FlagNameExpand   = "expand"
+)
+
+// addKDFCommand adds key derivation, so keys for "aes", "jwe --alg=dir" or
+// "jwt --key" can be derived from a master secret or a password rather than
+// generated and stored separately. The derived key is written raw.
+func addKDFCommand(rootCmd *cobra.Command, o *Options) {
+	kdfCmd := &cobra.Command{
+		Use:   "kdf",
+		Short: "Derive keys with HKDF or PBKDF2",
+	}
+
+	addHKDFCmd(kdfCmd)
+	addPBKDF2Cmd(kdfCmd, o)
+	rootCmd.AddCommand(kdfCmd)
+}
+
+// addHKDFCmd adds HKDF (RFC 5869) of the input keying material, typically a
+// master secret, into subkeys distinguished by their info.
+func addHKDFCmd(kdfCmd *cobra.Command) {
+	var saltFilename string
+	var info string
+	var infoFilename string
+	var hashName string
+	var length int
+	var extractOnly bool
+	var expandOnly bool
+
+	hkdfCmd := &cobra.Command{
+		Use:   "hkdf",
+		Short: "Derive a key from the input keying material with HKDF",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			hash, ok := rsaHashAlgorithms[hashName]
+			if !ok {
+				return fmt.Errorf("invalid %q flag %q: must be one of %v",
+					"--"+FlagNameHash, hashName, strings.Join(rsaHashNames, ", "))
+			}
+			if extractOnly && expandOnly {
+				return fmt.Errorf(`the "--%v" and "--%v" flags are mutually exclusive`, FlagNameExtract, FlagNameExpand)
+			}
+			if length <= 0 && !extractOnly {
+				return fmt.Errorf("invalid %q flag %v: must be positive", "--"+FlagNameLength, length)
+			}
+			if info != "" && infoFilename != "" {
+				return fmt.Errorf(`the "--%v" and "--%v" flags are mutually exclusive`, FlagNameInfo, FlagNameInfoFile)
+			}
+			salt, err := readOptionalFile(FlagNameSalt, saltFilename)
+			if err != nil {
+				return err
+			}
+			if infoFilename != "" {
+				bs, err := readOptionalFile(FlagNameInfoFile, infoFilename)
+				if err != nil {
+					return err
+				}
+				info = string(bs)
+			}
+			secret, err := io.ReadAll(cmd.InOrStdin())
+			if err != nil {
+				return fmt.Errorf("failed to read input keying material: %v", err)
+			}
+
+			var key []byte
+			switch {
+			case extractOnly:
+				if info != "" {
+					log.Printf("WARNING: ignoring irrelevant %q flag with %q", "--"+FlagNameInfo, "--"+FlagNameExtract)
+				}
+				key, err = hkdf.Extract(hash.New, secret, salt)
+			case expandOnly:
+				if saltFilename != "" {
+					log.Printf("WARNING: ignoring irrelevant %q flag with %q", "--"+FlagNameSalt, "--"+FlagNameExpand)
+				}
+				key, err = hkdf.Expand(hash.New, secret, info, length)
+			default:
+				key, err = hkdf.Key(hash.New, secret, salt, info, length)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to derive key: %v", err)
+			}
+			if _, err := cmd.OutOrStdout().Write(key); err != nil {
+				return fmt.Errorf("failed to write key: %v", err)
+			}
+			return nil
+		},
+	}
+
+	hkdfCmd.Flags().IntVarP(&length, FlagNameLength, "l", 32,
+		"length of the derived key in bytes")
+	hkdfCmd.Flags().StringVar(&saltFilename, FlagNameSalt, "",
+		"salt filename (optional)")
+	hkdfCmd.Flags().StringVar(&info, FlagNameInfo, "",
+		"context and application specific info, e.g. a service name (optional)")
+	hkdfCmd.Flags().StringVar(&infoFilename, FlagNameInfoFile, "",
+		"read the info from this file instead (optional)")
+	hkdfCmd.Flags().StringVarP(&hashName, FlagNameHash, "a", "sha256",
+		"hash algorithm: "+strings.Join(rsaHashNames, ", "))
+	hkdfCmd.Flags().BoolVar(&extractOnly, FlagNameExtract, false,
+		"only run HKDF-Extract, writing the pseudorandom key")
+	hkdfCmd.Flags().BoolVar(&expandOnly, FlagNameExpand, false,
+		"only run HKDF-Expand, reading a pseudorandom key as input")
+
+	kdfCmd.AddCommand(hkdfCmd)
+}
+
+// addPBKDF2Cmd adds PBKDF2 (RFC 8018) of a password, the same derivation
+// "aes --password-file" uses, but with a caller-chosen salt so the same key
+// can be derived again.
+func addPBKDF2Cmd(kdfCmd *cobra.Command, o *Options) {
+	var saltFilename string
+	var hashName string
+	var length int
+
+	pbkdf2Cmd := &cobra.Command{
+		Use:   "pbkdf2",
+		Short: "Derive a key from a password with PBKDF2",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			hash, ok := rsaHashAlgorithms[hashName]
+			if !ok {
+				return fmt.Errorf("invalid %q flag %q: must be one of %v",
+					"--"+FlagNameHash, hashName, strings.Join(rsaHashNames, ", "))
+			}
+			if length <= 0 {
+				return fmt.Errorf("invalid %q flag %v: must be positive", "--"+FlagNameLength, length)
+			}
+			if o.Iterations < 1 {
+				return fmt.Errorf(`invalid "--%v" value %v: must be positive`, FlagNameIterations, o.Iterations)
+			}
+			if saltFilename == "" {
+				return fmt.Errorf(`missing required "--%v" flag`, FlagNameSalt)
+			}
+			salt, err := readOptionalFile(FlagNameSalt, saltFilename)
+			if err != nil {
+				return err
+			}
+			if !usePassword(o) {
+				return fmt.Errorf(`missing "--%v" or "--%v" flag`, FlagNamePasswordFile, FlagNamePasswordEnv)
+			}
+			password, err := readPassword(o)
+			if err != nil {
+				return err
+			}
+
+			key, err := pbkdf2.Key(hash.New, password, salt, o.Iterations, length)
+			if err != nil {
+				return fmt.Errorf("failed to derive key: %v", err)
+			}
+			if _, err := cmd.OutOrStdout().Write(key); err != nil {
+				return fmt.Errorf("failed to write key: %v", err)
+			}
+			return nil
+		},
+	}
+
+	pbkdf2Cmd.Flags().StringVar(&o.PasswordFilename, FlagNamePasswordFile, "",
+		"read the password from this file")
+	pbkdf2Cmd.Flags().StringVar(&o.PasswordEnv, FlagNamePasswordEnv, "",
+		"read the password from this environment variable")
+	pbkdf2Cmd.Flags().IntVar(&o.Iterations, FlagNameIterations, DefaultPBKDF2Iterations,
+		"PBKDF2 iteration count")
+	pbkdf2Cmd.Flags().StringVar(&saltFilename, FlagNameSalt, "",
+		"salt filename (required)")
+	pbkdf2Cmd.Flags().IntVarP(&length, FlagNameLength, "l", 32,
+		"length of the derived key in bytes")
+	pbkdf2Cmd.Flags().StringVarP(&hashName, FlagNameHash, "a", "sha256",
+		"HMAC hash algorithm: "+strings.Join(rsaHashNames, ", "))
+
+	kdfCmd.AddCommand(pbkdf2Cmd)
+}
+
+// readOptionalFile reads the file named by an optional flag, returning nil
+// if the flag was not given.
+func readOptionalFile(flagName, filename string) ([]byte, error) {
+	if filename == "" {
+		return nil, nil
+	}
+	if isStd(filename) {
+		return nil, fmt.Errorf(`the %q flag does not support "-" (stdin); provide a file path`, "--"+flagName)
+	}
+	bs, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %v file: %v", strings.TrimSuffix(flagName, "-file"), err)
+	}
+	return bs, nil
+}
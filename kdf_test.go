@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/hex"
+	"path"
+	"strings"
+	"testing"
+)
+
+// RFC 5869, appendix A.1.
+func TestHKDFKnownAnswer(t *testing.T) {
+	tempDir := t.TempDir()
+	saltFilename := path.Join(tempDir, "salt")
+	mustWrite(t, saltFilename, mustHex("000102030405060708090a0b0c"))
+	infoFilename := path.Join(tempDir, "info")
+	mustWrite(t, infoFilename, mustHex("f0f1f2f3f4f5f6f7f8f9"))
+	ikm := string(mustHex("0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b"))
+	prk := "077709362c2e32df0ddc3f0dc47bba6390b6c73bb50f9c3122ec844ad7c2b3e5"
+	okm := "3cb25f25faacd57a90434f64d0362f2a2d2d0a90cf1a5a4c5db02d56ecc4c5bf34007208d5b887185865"
+
+	for _, eg := range []struct {
+		args  []string
+		input string
+		want  string
+	}{
+		{[]string{"kdf", "hkdf", "--salt", saltFilename, "--info-file", infoFilename, "--length", "42"}, ikm, okm},
+		{[]string{"kdf", "hkdf", "--salt", saltFilename, "--extract"}, ikm, prk},
+		{[]string{"kdf", "hkdf", "--info-file", infoFilename, "--length", "42", "--expand"}, string(mustHex(prk)), okm},
+	} {
+		key, _, err := runRSACmd(t, eg.args, eg.input)
+		if err != nil {
+			t.Fatalf("args=%#v: unexpected error: %v", eg.args, err)
+		}
+		if got := hex.EncodeToString([]byte(key)); got != eg.want {
+			t.Fatalf("args=%#v: wanted %v, got %v", eg.args, eg.want, got)
+		}
+	}
+}
+
+func TestHKDFSubkeys(t *testing.T) {
+	master := string(mustRand(32))
+	derive := func(args ...string) string {
+		key, _, err := runRSACmd(t, append([]string{"kdf", "hkdf"}, args...), master)
+		if err != nil {
+			t.Fatalf("args=%#v: unexpected error: %v", args, err)
+		}
+		return key
+	}
+
+	a, b := derive("--info", "service-a"), derive("--info", "service-b")
+	if len(a) != 32 || a == b {
+		t.Fatalf("wanted distinct 32-byte subkeys, got %x and %x", a, b)
+	}
+	if again := derive("--info", "service-a"); again != a {
+		t.Fatal("deriving the same subkey twice gave different keys")
+	}
+	if sha512 := derive("--info", "service-a", "--hash", "sha512", "--length", "64"); len(sha512) != 64 || sha512[:32] == a {
+		t.Fatalf("wanted a distinct 64-byte SHA-512 subkey, got %x", sha512)
+	}
+}
+
+func TestPBKDF2KnownAnswers(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, eg := range []struct {
+		hash, password, salt, iterations, length, want string
+	}{
+		// RFC 7914, section 11.
+		{"sha256", "passwd", "salt", "1", "64",
+			"55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"},
+		{"sha512", "password", "NaCl salt", "1000", "40",
+			"b01eb2f9cc8a7d69af0f0febd10aa0aabffa39aeb4bfd2ac84f417468da1ef7a77a83f2450495d15"},
+	} {
+		t.Setenv("ENC_TEST_PASSWORD", eg.password)
+		saltFilename := path.Join(tempDir, eg.hash+".salt")
+		mustWrite(t, saltFilename, []byte(eg.salt))
+		key, _, err := runRSACmd(t, []string{"kdf", "pbkdf2", "--password-env", "ENC_TEST_PASSWORD", "--salt", saltFilename,
+			"--iterations", eg.iterations, "--length", eg.length, "--hash", eg.hash}, "")
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v", eg.hash, err)
+		}
+		if got := hex.EncodeToString([]byte(key)); got != eg.want {
+			t.Fatalf("%v: wanted %v, got %v", eg.hash, eg.want, got)
+		}
+	}
+}
+
+func TestKDFErrors(t *testing.T) {
+	t.Setenv("ENC_TEST_PASSWORD", "hunter2")
+	saltFilename := path.Join(t.TempDir(), "salt")
+	mustWrite(t, saltFilename, []byte("salt"))
+
+	for _, tc := range []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"kdf", "hkdf", "--hash", "md5"}, `invalid "--hash" flag "md5": must be one of sha256, sha384, sha512`},
+		{[]string{"kdf", "hkdf", "--length", "0"}, `invalid "--length" flag 0: must be positive`},
+		{[]string{"kdf", "hkdf", "--length", "8161"}, "failed to derive key"},
+		{[]string{"kdf", "hkdf", "--extract", "--expand"}, `the "--extract" and "--expand" flags are mutually exclusive`},
+		{[]string{"kdf", "hkdf", "--info", "a", "--info-file", saltFilename}, `the "--info" and "--info-file" flags are mutually exclusive`},
+		{[]string{"kdf", "hkdf", "--salt", "-"}, `the "--salt" flag does not support "-"`},
+		{[]string{"kdf", "pbkdf2", "--password-env", "ENC_TEST_PASSWORD"}, `missing required "--salt" flag`},
+		{[]string{"kdf", "pbkdf2", "--salt", saltFilename}, `missing "--password-file" or "--password-env" flag`},
+		{[]string{"kdf", "pbkdf2", "--salt", saltFilename, "--password-env", "ENC_TEST_PASSWORD", "--iterations", "0"},
+			`invalid "--iterations" value 0: must be positive`},
+	} {
+		_, _, err := runRSACmd(t, tc.args, "secret")
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Fatalf("args=%#v: expected error containing %q, got %v", tc.args, tc.err, err)
+		}
+	}
+}
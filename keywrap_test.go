@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/hex"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestKeyWrapKnownAnswers(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, eg := range []struct {
+		name, mode, kek, key, want string
+	}{
+		// RFC 3394, sections 4.1 to 4.6.
+		{"4.1", "kw", "000102030405060708090a0b0c0d0e0f",
+			"00112233445566778899aabbccddeeff",
+			"1fa68b0a8112b447aef34bd8fb5a7b829d3e862371d2cfe5"},
+		{"4.2", "kw", "000102030405060708090a0b0c0d0e0f1011121314151617",
+			"00112233445566778899aabbccddeeff",
+			"96778b25ae6ca435f92b5b97c050aed2468ab8a17ad84e5d"},
+		{"4.3", "kw", "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f",
+			"00112233445566778899aabbccddeeff",
+			"64e8c3f9ce0f5ba263e9777905818a2a93c8191e7d6e8ae7"},
+		{"4.4", "kw", "000102030405060708090a0b0c0d0e0f1011121314151617",
+			"00112233445566778899aabbccddeeff0001020304050607",
+			"031d33264e15d33268f24ec260743edce1c6c7ddee725a936ba814915c6762d2"},
+		{"4.5", "kw", "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f",
+			"00112233445566778899aabbccddeeff0001020304050607",
+			"a8f9bc1612c68b3ff6e6f4fbe30e71e4769c8b80a32cb8958cd5d17d6b254da1"},
+		{"4.6", "kw", "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f",
+			"00112233445566778899aabbccddeeff000102030405060708090a0b0c0d0e0f",
+			"28c9f404c4b810f4cbccb35cfb87f8263f5786e2d80ed326cbc7f0e71a99f43bfb988b9b7a02dd21"},
+		// RFC 5649, section 6.
+		{"5649 20 bytes", "kwp", "5840df6e29b02af1ab493b705bf16ea1ae8338f4dcc176a8",
+			"c37b7e6492584340bed12207808941155068f738",
+			"138bdeaa9b8fa7fc61f97742e72248ee5ae6ae5360d1ae6a5f54f373fa543b6a"},
+		{"5649 7 bytes", "kwp", "5840df6e29b02af1ab493b705bf16ea1ae8338f4dcc176a8",
+			"466f7250617369",
+			"afbeb0f07dfbf5419200f2ccb50bb24f"},
+	} {
+		kekFilename := path.Join(tempDir, strings.ReplaceAll(eg.name, " ", "-")+".kek")
+		mustWrite(t, kekFilename, mustHex(eg.kek))
+
+		wrapped, _, err := runRSACmd(t, []string{"keywrap", "--mode", eg.mode, "--kek", kekFilename}, string(mustHex(eg.key)))
+		if err != nil {
+			t.Fatalf("%v: unexpected wrap error: %v", eg.name, err)
+		}
+		if got := hex.EncodeToString([]byte(wrapped)); got != eg.want {
+			t.Fatalf("%v: wanted %v, got %v", eg.name, eg.want, got)
+		}
+		key, _, err := runRSACmd(t, []string{"keywrap", "--decrypt", "--mode", eg.mode, "--kek", kekFilename}, wrapped)
+		if err != nil {
+			t.Fatalf("%v: unexpected unwrap error: %v", eg.name, err)
+		}
+		if got := hex.EncodeToString([]byte(key)); got != eg.key {
+			t.Fatalf("%v: wanted %v, got %v", eg.name, eg.key, got)
+		}
+	}
+}
+
+func TestKeyWrapPaddingRoundtrip(t *testing.T) {
+	kekFilename := path.Join(t.TempDir(), "kek")
+	mustWrite(t, kekFilename, mustRand(32))
+	for size := 1; size <= 33; size++ {
+		key := string(mustRand(size))
+		wrapped, _, err := runRSACmd(t, []string{"keywrap", "--mode", "kwp", "--kek", kekFilename}, key)
+		if err != nil {
+			t.Fatalf("%v bytes: unexpected wrap error: %v", size, err)
+		}
+		if want := (size+7)/8*8 + 8; len(wrapped) != want {
+			t.Fatalf("%v bytes: wanted %v wrapped bytes, got %v", size, want, len(wrapped))
+		}
+		unwrapped, _, err := runRSACmd(t, []string{"keywrap", "--decrypt", "--mode", "kwp", "--kek", kekFilename}, wrapped)
+		if err != nil {
+			t.Fatalf("%v bytes: unexpected unwrap error: %v", size, err)
+		}
+		if unwrapped != key {
+			t.Fatalf("%v bytes: roundtrip failed", size)
+		}
+	}
+}
+
+func TestKeyUnwrapIntegrity(t *testing.T) {
+	tempDir := t.TempDir()
+	kekFilename := path.Join(tempDir, "kek")
+	mustWrite(t, kekFilename, mustRand(16))
+	otherKEKFilename := path.Join(tempDir, "other.kek")
+	mustWrite(t, otherKEKFilename, mustRand(16))
+
+	for _, eg := range []struct {
+		mode string
+		size int
+	}{
+		{"kw", 16}, {"kw", 32}, {"kwp", 16}, {"kwp", 5},
+	} {
+		wrapped, _, err := runRSACmd(t, []string{"keywrap", "--mode", eg.mode, "--kek", kekFilename}, string(mustRand(eg.size)))
+		if err != nil {
+			t.Fatalf("%v/%v bytes: unexpected wrap error: %v", eg.mode, eg.size, err)
+		}
+		tampered := []byte(wrapped)
+		tampered[len(tampered)-1] ^= 1
+
+		for _, tc := range []struct {
+			name, kek, input string
+		}{
+			{"tampered", kekFilename, string(tampered)},
+			{"wrong kek", otherKEKFilename, wrapped},
+		} {
+			_, _, err := runRSACmd(t, []string{"keywrap", "--decrypt", "--mode", eg.mode, "--kek", tc.kek}, tc.input)
+			if err == nil || !strings.Contains(err.Error(), "integrity check failed") {
+				t.Fatalf("%v/%v bytes/%v: expected an integrity error, got %v", eg.mode, eg.size, tc.name, err)
+			}
+		}
+	}
+
+	// A key wrapped in one mode does not unwrap in the other.
+	wrapped, _, err := runRSACmd(t, []string{"keywrap", "--mode", "kwp", "--kek", kekFilename}, string(mustRand(16)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := runRSACmd(t, []string{"keywrap", "--decrypt", "--kek", kekFilename}, wrapped); err == nil {
+		t.Fatal("expected a kwp wrapped key not to unwrap in kw mode")
+	}
+}
+
+func TestKeyWrapErrors(t *testing.T) {
+	tempDir := t.TempDir()
+	kekFilename := path.Join(tempDir, "kek")
+	mustWrite(t, kekFilename, mustRand(16))
+	badKEKFilename := path.Join(tempDir, "bad.kek")
+	mustWrite(t, badKEKFilename, mustRand(20))
+
+	for _, tc := range []struct {
+		args  []string
+		input string
+		err   string
+	}{
+		{[]string{"keywrap"}, "0123456789abcdef", `missing required "--kek" flag`},
+		{[]string{"keywrap", "--kek", "-"}, "0123456789abcdef", `the "--kek" flag does not support "-"`},
+		{[]string{"keywrap", "--kek", badKEKFilename}, "0123456789abcdef", "failed to create AES cipher"},
+		{[]string{"keywrap", "--kek", kekFilename, "--mode", "gcm"}, "0123456789abcdef", `invalid "--mode" flag "gcm": must be one of kw, kwp`},
+		{[]string{"keywrap", "--kek", kekFilename}, "01234567", `is not a multiple of 8 of at least 16; use "--mode=kwp"`},
+		{[]string{"keywrap", "--kek", kekFilename}, "0123456789abcdef0", `is not a multiple of 8 of at least 16`},
+		{[]string{"keywrap", "--kek", kekFilename, "--mode", "kwp"}, "", "failed to wrap key: 0 byte(s)"},
+		{[]string{"keywrap", "--decrypt", "--kek", kekFilename}, "0123456789abcdef", "is not a multiple of 8 of at least 24"},
+		{[]string{"keywrap", "--decrypt", "--kek", kekFilename, "--mode", "kwp"}, "01234567", "is not a multiple of 8 of at least 16"},
+	} {
+		_, _, err := runRSACmd(t, tc.args, tc.input)
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Fatalf("args=%#v: expected error containing %q, got %v", tc.args, tc.err, err)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/hex"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestMACKnownAnswers(t *testing.T) {
+	tempDir := t.TempDir()
+	// NIST SP 800-185 KMAC samples 1 and 2.
+	kmacKey := "404142434445464748494a4b4c4d4e4f505152535455565758595a5b5c5d5e5f"
+
+	for _, eg := range []struct {
+		name, alg, key, message string
+		args                    []string
+		want                    string
+	}{
+		// RFC 4231, test case 2.
+		{"rfc4231-sha256", "hmac-sha256", hex.EncodeToString([]byte("Jefe")), "what do ya want for nothing?", nil,
+			"5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"},
+		{"rfc4231-sha384", "hmac-sha384", hex.EncodeToString([]byte("Jefe")), "what do ya want for nothing?", nil,
+			"af45d2e376484031617f78d2b58a6b1b9c7ef464f5a01b47e42ec3736322445e8e2240ca5e69e2c78b3239ecfab21649"},
+		{"rfc4231-sha512", "hmac-sha512", hex.EncodeToString([]byte("Jefe")), "what do ya want for nothing?", nil,
+			"164b7a7bfcf819e2e395fbe73b56e0a387bd64222e831fd610270cd7ea2505549758bf75c05a994a6d034f65f8f0e6fdcaeab1a34d4a6b4b636e070a38bce737"},
+		// RFC 4493, section 4, examples 1 and 2.
+		{"rfc4493-empty", "cmac-aes", "2b7e151628aed2a6abf7158809cf4f3c", "", nil,
+			"bb1d6929e95937287fa37d129b756746"},
+		{"rfc4493-16", "cmac-aes", "2b7e151628aed2a6abf7158809cf4f3c", string(mustHex("6bc1bee22e409f96e93d7e117393172a")), nil,
+			"070a16b46b4d4144f79bdd9dd04a287c"},
+		{"kmac-sample1", "kmac128", kmacKey, string(mustHex("00010203")), nil,
+			"e5780b0d3ea6f7d3a429c5706aa43a00fadbd7d49628839e3187243f456ee14e"},
+		{"kmac-sample2", "kmac128", kmacKey, string(mustHex("00010203")), []string{"--customization", "My Tagged Application"},
+			"3b1fba963cd8b0b59e8c1a6d71888b7143651af8ba0a7070c0979e2811324aa5"},
+	} {
+		keyFilename := path.Join(tempDir, eg.name+".key")
+		mustWrite(t, keyFilename, mustHex(eg.key))
+		tagFilename := path.Join(tempDir, eg.name+".tag")
+
+		args := append([]string{"mac", "--alg", eg.alg, "--key", keyFilename}, eg.args...)
+		tag, _, err := runRSACmd(t, args, eg.message)
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v", eg.name, err)
+		}
+		if got := hex.EncodeToString([]byte(tag)); got != eg.want {
+			t.Fatalf("%v: wanted %v, got %v", eg.name, eg.want, got)
+		}
+
+		mustWrite(t, tagFilename, []byte(tag))
+		out, _, err := runRSACmd(t, append(args, "--decrypt", "--tag", tagFilename), eg.message)
+		if err != nil {
+			t.Fatalf("%v: unexpected verification error: %v", eg.name, err)
+		}
+		if out != eg.message {
+			t.Fatalf("%v: wanted the input %q passed through, got %q", eg.name, eg.message, out)
+		}
+	}
+}
+
+func TestMACVerifyFailures(t *testing.T) {
+	tempDir := t.TempDir()
+	keyFilename := path.Join(tempDir, "mac.key")
+	mustWrite(t, keyFilename, mustRand(32))
+	message := "Hello, MAC! 🔐"
+
+	for _, alg := range macAlgNames {
+		tag, _, err := runRSACmd(t, []string{"mac", "--alg", alg, "--key", keyFilename}, message)
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v", alg, err)
+		}
+		tagFilename := path.Join(tempDir, alg+".tag")
+		mustWrite(t, tagFilename, []byte(tag))
+		truncatedFilename := path.Join(tempDir, alg+".truncated")
+		mustWrite(t, truncatedFilename, []byte(tag[:len(tag)/2]))
+
+		for _, tc := range []struct {
+			name    string
+			args    []string
+			message string
+		}{
+			{"tampered message", []string{"--tag", tagFilename}, message + "!"},
+			{"truncated tag", []string{"--tag", truncatedFilename}, message},
+			{"other algorithm", []string{"--tag", tagFilename, "--alg", otherMACAlg(alg)}, message},
+			{"customization", []string{"--tag", tagFilename, "--customization", "other"}, message},
+		} {
+			if tc.name == "customization" && alg != MACAlgKMAC128 {
+				continue
+			}
+			args := append([]string{"mac", "--decrypt", "--alg", alg, "--key", keyFilename}, tc.args...)
+			out, _, err := runRSACmd(t, args, tc.message)
+			if err == nil || !strings.Contains(err.Error(), "MAC verification failed") {
+				t.Fatalf("%v/%v: expected a verification error, got %v", alg, tc.name, err)
+			}
+			if strings.Contains(out, message) {
+				t.Fatalf("%v/%v: passed the input through despite the failed check", alg, tc.name)
+			}
+		}
+	}
+}
+
+func otherMACAlg(alg string) string {
+	if alg == MACAlgHMACSHA256 {
+		return MACAlgKMAC128
+	}
+	return MACAlgHMACSHA256
+}
+
+func TestMACErrors(t *testing.T) {
+	keyFilename := path.Join(t.TempDir(), "mac.key")
+	mustWrite(t, keyFilename, mustRand(20))
+
+	for _, tc := range []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"mac"}, `missing required "--key" flag`},
+		{[]string{"mac", "--key", keyFilename, "--alg", "poly1305"},
+			`invalid "--alg" flag "poly1305": must be one of hmac-sha256, hmac-sha384, hmac-sha512, cmac-aes, kmac128`},
+		{[]string{"mac", "--key", keyFilename, "--alg", "cmac-aes"}, "failed to create AES cipher"},
+		{[]string{"mac", "--decrypt", "--key", keyFilename}, `missing required "--tag" flag`},
+		{[]string{"mac", "--decrypt", "--key", keyFilename, "--tag", "-"}, `the "--tag" flag does not support "-"`},
+	} {
+		_, _, err := runRSACmd(t, tc.args, "message")
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Fatalf("args=%#v: expected error containing %q, got %v", tc.args, tc.err, err)
+		}
+	}
+}
@@ -28,7 +28,9 @@ const (
 	FlagNameKey        = "key"
 	FlagNameIV         = "iv"
 	FlagNameOmitIV     = "omit-iv"
+	FlagNameTagFile    = "tag-file"
 	FlagNamePad        = "pad"
+	FlagNamePadding    = "padding"
 )
 
 type Options struct {
@@ -51,18 +53,37 @@ type Options struct {
 
 	PrivateKeyFilename string
 	PublicKeyFilename  string
+	PublicKeyFilenames []string
 	KeyFilename        string
+	RSADirect          bool
 
 	AdditionalDataFilename       string
 	InitializationVectorFilename string
 	OmitInitializationVector     bool
+	TagFilename                  string
 	Strict                       bool
 
-	PadFilename string
-	ForcePad    bool
-	DeletePad   bool
+	PasswordFilename string
+	PasswordEnv      string
+	Iterations       int
+	KeySizeBits      int
+
+	OpenSSL    bool
+	OpenSSLKDF string
+
+	PadFilename      string
+	ForcePad         bool
+	DeletePad        bool
+	PadBook          bool
+	PadStateFilename string
+	PadAuthenticated bool
 
 	CryptoMode cryptoMode
+	Padding    paddingScheme
+	Envelope   bool
+	// EnvelopeBytes is the serialized envelope written or read, which the
+	// AEAD modes authenticate as additional data.
+	EnvelopeBytes []byte
 }
 
 func (o *Options) EncryptionModeString() string {
@@ -112,11 +133,22 @@ func newEncCmd(options *Options) *cobra.Command {
 	addStreamingCodecs(encCmd, options)
 	addBufferedCodecs(encCmd, options)
 	addSymmetricCryptoCommands(encCmd, options)
+	addChaCha20Commands(encCmd, options)
 	addRSACommands(encCmd, options)
 	addEd25519Commands(encCmd, options)
+	addECDHCommands(encCmd, options)
+	addECIESCommand(encCmd, options)
+	addMLKEMCommands(encCmd, options)
+	addAgeCommand(encCmd, options)
 	addJWTCommand(encCmd, options)
 	addJWECommand(encCmd, options)
 	addOTPCommand(encCmd, options)
+	addShamirCommand(encCmd, options)
+	addOTPCodeCommands(encCmd)
+	addKDFCommand(encCmd, options)
+	addKeyWrapCommand(encCmd, options)
+	addMACCommand(encCmd, options)
+	addHashCommand(encCmd)
 
 	encCmd.Run = func(cmd *cobra.Command, args []string) {
 		if printVersion {
@@ -0,0 +1,478 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/mlkem"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	FlagNameSharedKey        = "shared-key"
+	FlagNameX25519PrivateKey = "x25519-private-key"
+	FlagNameX25519PublicKey  = "x25519-public-key"
+)
+
+// mlkemHybridInfo is the HKDF info for the hybrid content key, binding it to
+// this scheme.
+const mlkemHybridInfo = "enc mlkem X25519 AES-256-GCM"
+
+// The standard library's ML-KEM keys have a concrete type per parameter set;
+// these cover both.
+type mlkemDecapsulationKey interface {
+	Bytes() []byte
+	Decapsulate(ciphertext []byte) (sharedKey []byte, err error)
+}
+
+type mlkemEncapsulationKey interface {
+	Bytes() []byte
+	Encapsulate() (sharedKey, ciphertext []byte)
+}
+
+type mlkemParams struct {
+	name           string
+	size           int
+	ciphertextSize int
+
+	generateKey         func() (mlkemDecapsulationKey, error)
+	newDecapsulationKey func(seed []byte) (mlkemDecapsulationKey, error)
+	newEncapsulationKey func(bs []byte) (mlkemEncapsulationKey, error)
+	encapsulationKey    func(dk mlkemDecapsulationKey) mlkemEncapsulationKey
+}
+
+func (p mlkemParams) privateKeyPEMType() string { return p.name + " PRIVATE KEY" }
+func (p mlkemParams) publicKeyPEMType() string  { return p.name + " PUBLIC KEY" }
+
+var mlkemParamSets = []mlkemParams{
+	{
+		name:           "ML-KEM-768",
+		size:           768,
+		ciphertextSize: mlkem.CiphertextSize768,
+		generateKey: func() (mlkemDecapsulationKey, error) {
+			return mlkem.GenerateKey768()
+		},
+		newDecapsulationKey: func(seed []byte) (mlkemDecapsulationKey, error) {
+			return mlkem.NewDecapsulationKey768(seed)
+		},
+		newEncapsulationKey: func(bs []byte) (mlkemEncapsulationKey, error) {
+			return mlkem.NewEncapsulationKey768(bs)
+		},
+		encapsulationKey: func(dk mlkemDecapsulationKey) mlkemEncapsulationKey {
+			return dk.(*mlkem.DecapsulationKey768).EncapsulationKey()
+		},
+	},
+	{
+		name:           "ML-KEM-1024",
+		size:           1024,
+		ciphertextSize: mlkem.CiphertextSize1024,
+		generateKey: func() (mlkemDecapsulationKey, error) {
+			return mlkem.GenerateKey1024()
+		},
+		newDecapsulationKey: func(seed []byte) (mlkemDecapsulationKey, error) {
+			return mlkem.NewDecapsulationKey1024(seed)
+		},
+		newEncapsulationKey: func(bs []byte) (mlkemEncapsulationKey, error) {
+			return mlkem.NewEncapsulationKey1024(bs)
+		},
+		encapsulationKey: func(dk mlkemDecapsulationKey) mlkemEncapsulationKey {
+			return dk.(*mlkem.DecapsulationKey1024).EncapsulationKey()
+		},
+	},
+}
+
+var mlkemSizes = []string{"768", "1024"}
+
+// addMLKEMCommands adds the ML-KEM (FIPS 203) key encapsulation commands.
+// The standard library has no PKCS8/PKIX encoding for ML-KEM keys, so the
+// private key is stored as its 64-byte seed in a "ML-KEM-768 PRIVATE KEY"
+// (or "ML-KEM-1024 PRIVATE KEY") PEM block, and the public key as its raw
+// encapsulation key in a matching "PUBLIC KEY" block.
+//
+// "enc mlkem" itself is hybrid encryption, secure as long as either X25519
+// or ML-KEM is: it encapsulates a shared key to the recipient's ML-KEM
+// public key, agrees on another with an ephemeral X25519 key and the
+// recipient's X25519 public key, and derives an AES-256-GCM key from both
+// with HKDF-SHA256, salted with the ML-KEM ciphertext and both X25519 public
+// keys. The output is
+//
+//	ML-KEM ciphertext (1088 or 1568 bytes) || ephemeral X25519 public key (32 bytes) ||
+//	nonce (12 bytes) || ciphertext || tag (16 bytes)
+//
+// where everything before the nonce is also authenticated as GCM additional
+// data.
+func addMLKEMCommands(rootCmd *cobra.Command, o *Options) {
+	var x25519PrivateFilename string
+	var x25519PublicFilename string
+
+	short := "Encrypt input using ML-KEM and X25519 public keys"
+	if o.Decode {
+		short = "Decrypt input using ML-KEM and X25519 private keys"
+	}
+
+	mlkemCmd := &cobra.Command{
+		Use:     "mlkem",
+		Short:   short,
+		Args:    cobra.NoArgs,
+		Aliases: []string{"ml-kem", "kyber"},
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if o.Decode {
+				return mlkemHybridDecrypt(cmd, o, x25519PrivateFilename)
+			}
+			return mlkemHybridEncrypt(cmd, o, x25519PublicFilename)
+		},
+	}
+
+	mlkemCmd.Flags().StringVar(&o.PrivateKeyFilename, FlagNamePrivateKey, "",
+		"ML-KEM private key filename, for decrypting")
+	mlkemCmd.Flags().StringVar(&o.PublicKeyFilename, FlagNamePublicKey, "",
+		"ML-KEM public key filename, for encrypting")
+	mlkemCmd.Flags().StringVarP(&o.KeyFilename, FlagNameKey, "k", "",
+		"ML-KEM public or private key filename, depending on context")
+	mlkemCmd.Flags().StringVar(&x25519PrivateFilename, FlagNameX25519PrivateKey, "",
+		"X25519 private key filename, for decrypting")
+	mlkemCmd.Flags().StringVar(&x25519PublicFilename, FlagNameX25519PublicKey, "",
+		"X25519 public key filename, for encrypting")
+
+	addMLKEMGenerateCmd(mlkemCmd)
+	addMLKEMExtractPublicKeyCmd(mlkemCmd)
+	addMLKEMEncapsulateCmd(mlkemCmd)
+	addMLKEMDecapsulateCmd(mlkemCmd)
+	rootCmd.AddCommand(mlkemCmd)
+}
+
+func addMLKEMGenerateCmd(mlkemCmd *cobra.Command) {
+	var size int
+	var privateFilename string
+	var publicFilename string
+
+	generateCmd := &cobra.Command{
+		Use:     "generate",
+		Aliases: []string{"gen"},
+		Short:   "Generate a new ML-KEM private key pair",
+		Args:    cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			params, ok := lookupMLKEMParams(size)
+			if !ok {
+				return fmt.Errorf("invalid %q flag %v: must be one of %v",
+					"--size", size, strings.Join(mlkemSizes, ", "))
+			}
+			privateKey, err := params.generateKey()
+			if err != nil {
+				return fmt.Errorf("failed to generate %v key: %v", params.name, err)
+			}
+
+			privateWriter := fileWriter(mlkemCmd, FilenameDescriptionPrivateKey, privateFilename, true, 0400)
+			publicWriter := fileWriter(mlkemCmd, FilenameDescriptionPublicKey, publicFilename, true, 0444)
+
+			if err := pem.Encode(privateWriter, &pem.Block{Type: params.privateKeyPEMType(), Bytes: privateKey.Bytes()}); err != nil {
+				return fmt.Errorf("failed to write private key: %v", err)
+			}
+			return writeMLKEMPublicKey(publicWriter, params, params.encapsulationKey(privateKey))
+		},
+	}
+
+	generateCmd.Flags().IntVarP(&size, "size", "s", 768,
+		"ML-KEM parameter set: "+strings.Join(mlkemSizes, ", "))
+
+	generateCmd.Flags().StringVar(&privateFilename, FlagNamePrivateKey, "-",
+		"file from which to read or write the private key")
+
+	generateCmd.Flags().StringVar(&publicFilename, FlagNamePublicKey, "-",
+		"file from which to read or write the public key")
+
+	mlkemCmd.AddCommand(generateCmd)
+}
+
+func addMLKEMExtractPublicKeyCmd(mlkemCmd *cobra.Command) {
+	var privateFilename string
+	var publicFilename string
+
+	extractPublicKeyCmd := &cobra.Command{
+		Use:     "extract",
+		Aliases: []string{"extract-public-key", "extract-public", "epk", "ep", "e"},
+		Short:   "Extract the public key from a given private key",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			privateReader := fileReader(cmd, "private", privateFilename, true)
+			privateKeyBytes, err := io.ReadAll(privateReader)
+			if err != nil {
+				return fmt.Errorf("failed to read private key bytes: %v", err)
+			}
+			params, privateKey, err := parseMLKEMPrivateKey(privateKeyBytes)
+			if err != nil {
+				return err
+			}
+			publicWriter := fileWriter(mlkemCmd, FilenameDescriptionPublicKey, publicFilename, true, 0444)
+			return writeMLKEMPublicKey(publicWriter, params, params.encapsulationKey(privateKey))
+		},
+	}
+
+	extractPublicKeyCmd.Flags().StringVar(&privateFilename, FlagNamePrivateKey, "-",
+		"file from which to read or write the private key")
+
+	extractPublicKeyCmd.Flags().StringVar(&publicFilename, FlagNamePublicKey, "-",
+		"file from which to read or write the public key")
+
+	mlkemCmd.AddCommand(extractPublicKeyCmd)
+}
+
+func addMLKEMEncapsulateCmd(mlkemCmd *cobra.Command) {
+	var publicFilename string
+	var sharedKeyFilename string
+
+	encapsulateCmd := &cobra.Command{
+		Use:     "encapsulate",
+		Aliases: []string{"encap"},
+		Short:   "Encapsulate a new shared key to an ML-KEM public key, writing the ciphertext",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if isStd(sharedKeyFilename) {
+				return fmt.Errorf(`missing or invalid value for %q flag %q: provide a file path`,
+					"--"+FlagNameSharedKey, sharedKeyFilename)
+			}
+			_, publicKey, err := readMLKEMPublicKey(cmd, publicFilename)
+			if err != nil {
+				return err
+			}
+			sharedKey, ciphertext := publicKey.Encapsulate()
+
+			sharedKeyWriter := fileWriter(cmd, "shared key", sharedKeyFilename, false, 0600)
+			if _, err := sharedKeyWriter.Write(sharedKey); err != nil {
+				return fmt.Errorf("failed to write shared key: %v", err)
+			}
+			if _, err := cmd.OutOrStdout().Write(ciphertext); err != nil {
+				return fmt.Errorf("failed to write ciphertext: %v", err)
+			}
+			return nil
+		},
+	}
+
+	encapsulateCmd.Flags().StringVar(&publicFilename, FlagNamePublicKey, "",
+		"public key filename")
+	encapsulateCmd.Flags().StringVar(&sharedKeyFilename, FlagNameSharedKey, "",
+		"file to write the 32-byte shared key to (required; must not exist)")
+
+	mlkemCmd.AddCommand(encapsulateCmd)
+}
+
+func addMLKEMDecapsulateCmd(mlkemCmd *cobra.Command) {
+	var privateFilename string
+
+	decapsulateCmd := &cobra.Command{
+		Use:     "decapsulate",
+		Aliases: []string{"decap"},
+		Short:   "Decapsulate the shared key from an ML-KEM ciphertext",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			params, privateKey, err := readMLKEMPrivateKey(cmd, privateFilename)
+			if err != nil {
+				return err
+			}
+			ciphertext, err := io.ReadAll(cmd.InOrStdin())
+			if err != nil {
+				return fmt.Errorf("failed to read ciphertext from stdin: %v", err)
+			}
+			if len(ciphertext) != params.ciphertextSize {
+				return fmt.Errorf("invalid %v ciphertext size %v bytes, expected %v", params.name, len(ciphertext), params.ciphertextSize)
+			}
+			sharedKey, err := privateKey.Decapsulate(ciphertext)
+			if err != nil {
+				return fmt.Errorf("failed to decapsulate: %v", err)
+			}
+			if _, err := cmd.OutOrStdout().Write(sharedKey); err != nil {
+				return fmt.Errorf("failed to write shared key: %v", err)
+			}
+			return nil
+		},
+	}
+
+	decapsulateCmd.Flags().StringVar(&privateFilename, FlagNamePrivateKey, "",
+		"private key filename")
+
+	mlkemCmd.AddCommand(decapsulateCmd)
+}
+
+func mlkemHybridEncrypt(cmd *cobra.Command, o *Options, x25519PublicFilename string) error {
+	if o.PrivateKeyFilename != "" {
+		log.Printf("WARNING: ignoring irrelevant %q flag", "--"+FlagNamePrivateKey)
+	}
+	_, publicKey, err := readMLKEMPublicKey(cmd, parseKeyFlagFrom(o, FlagNamePublicKey, o.PublicKeyFilename))
+	if err != nil {
+		return err
+	}
+	if isStd(x25519PublicFilename) {
+		return fmt.Errorf(`missing required %q flag`, "--"+FlagNameX25519PublicKey)
+	}
+	x25519PublicKey, err := readECDHPublicKey(cmd, x25519PublicFilename, ecdh.X25519())
+	if err != nil {
+		return err
+	}
+	plaintext, err := io.ReadAll(cmd.InOrStdin())
+	if err != nil {
+		return fmt.Errorf("failed to read plaintext from stdin: %v", err)
+	}
+
+	mlkemSharedKey, mlkemCiphertext := publicKey.Encapsulate()
+	ephemeralKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to generate ephemeral X25519 key: %v", err)
+	}
+	x25519SharedKey, err := ephemeralKey.ECDH(x25519PublicKey)
+	if err != nil {
+		return fmt.Errorf("failed to agree on a shared secret: %v", err)
+	}
+
+	header := append(mlkemCiphertext, ephemeralKey.PublicKey().Bytes()...)
+	gcm, err := newMLKEMHybridGCM(mlkemSharedKey, x25519SharedKey, header, x25519PublicKey)
+	if err != nil {
+		return err
+	}
+	ciphertextWriter := &prefixWriter{cmd.OutOrStdout(), header}
+	return sealAEAD(gcm, plaintext, header, ciphertextWriter)
+}
+
+func mlkemHybridDecrypt(cmd *cobra.Command, o *Options, x25519PrivateFilename string) error {
+	if o.PublicKeyFilename != "" {
+		log.Printf("WARNING: ignoring irrelevant %q flag", "--"+FlagNamePublicKey)
+	}
+	params, privateKey, err := readMLKEMPrivateKey(cmd, parseKeyFlagFrom(o, FlagNamePrivateKey, o.PrivateKeyFilename))
+	if err != nil {
+		return err
+	}
+	if isStd(x25519PrivateFilename) {
+		return fmt.Errorf(`missing required %q flag`, "--"+FlagNameX25519PrivateKey)
+	}
+	x25519PrivateKey, err := readECDHPrivateKey(cmd, x25519PrivateFilename, ecdh.X25519())
+	if err != nil {
+		return err
+	}
+	ciphertext, err := io.ReadAll(cmd.InOrStdin())
+	if err != nil {
+		return fmt.Errorf("failed to read ciphertext from stdin: %v", err)
+	}
+
+	headerSize := params.ciphertextSize + 32
+	if len(ciphertext) < headerSize {
+		return fmt.Errorf("ciphertext too short: %v bytes, need at least %v for the %v ciphertext and ephemeral X25519 public key",
+			len(ciphertext), headerSize, params.name)
+	}
+	header := ciphertext[:headerSize]
+	mlkemSharedKey, err := privateKey.Decapsulate(header[:params.ciphertextSize])
+	if err != nil {
+		return fmt.Errorf("failed to decapsulate: %v", err)
+	}
+	ephemeralKey, err := ecdh.X25519().NewPublicKey(header[params.ciphertextSize:])
+	if err != nil {
+		return fmt.Errorf("invalid ephemeral public key: %v", err)
+	}
+	x25519SharedKey, err := x25519PrivateKey.ECDH(ephemeralKey)
+	if err != nil {
+		return fmt.Errorf("failed to agree on a shared secret: %v", err)
+	}
+
+	gcm, err := newMLKEMHybridGCM(mlkemSharedKey, x25519SharedKey, header, x25519PrivateKey.PublicKey())
+	if err != nil {
+		return err
+	}
+	return openAEAD(gcm, ciphertext[headerSize:], header, cmd.OutOrStdout())
+}
+
+func newMLKEMHybridGCM(mlkemSharedKey, x25519SharedKey, header []byte, recipientKey *ecdh.PublicKey) (cipher.AEAD, error) {
+	secret := append(append([]byte{}, mlkemSharedKey...), x25519SharedKey...)
+	salt := append(append([]byte{}, header...), recipientKey.Bytes()...)
+	key, err := hkdf.Key(sha256.New, secret, salt, mlkemHybridInfo, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive content key: %v", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AES cipher: %v", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize GCM AEAD mode: %v", err)
+	}
+	return gcm, nil
+}
+
+func lookupMLKEMParams(size int) (mlkemParams, bool) {
+	for _, params := range mlkemParamSets {
+		if params.size == size {
+			return params, true
+		}
+	}
+	return mlkemParams{}, false
+}
+
+func writeMLKEMPublicKey(w io.Writer, params mlkemParams, publicKey mlkemEncapsulationKey) error {
+	if err := pem.Encode(w, &pem.Block{Type: params.publicKeyPEMType(), Bytes: publicKey.Bytes()}); err != nil {
+		return fmt.Errorf("failed to write public key: %v", err)
+	}
+	return nil
+}
+
+func readMLKEMPrivateKey(cmd *cobra.Command, filename string) (mlkemParams, mlkemDecapsulationKey, error) {
+	reader := fileReader(cmd, FilenameDescriptionPrivateKey, filename, false)
+	if reader == nil {
+		return mlkemParams{}, nil, fmt.Errorf(`missing or invalid value for %v flag %v=%q`,
+			FilenameDescriptionPrivateKey, "--"+FlagNamePrivateKey, filename)
+	}
+	bs, err := io.ReadAll(reader)
+	if err != nil {
+		return mlkemParams{}, nil, fmt.Errorf("failed to read private key bytes: %v", err)
+	}
+	return parseMLKEMPrivateKey(bs)
+}
+
+func readMLKEMPublicKey(cmd *cobra.Command, filename string) (mlkemParams, mlkemEncapsulationKey, error) {
+	reader := fileReader(cmd, FilenameDescriptionPublicKey, filename, false)
+	if reader == nil {
+		return mlkemParams{}, nil, fmt.Errorf(`missing or invalid value for %v flag %v=%q`,
+			FilenameDescriptionPublicKey, "--"+FlagNamePublicKey, filename)
+	}
+	bs, err := io.ReadAll(reader)
+	if err != nil {
+		return mlkemParams{}, nil, fmt.Errorf("failed to read public key bytes: %v", err)
+	}
+	block, _ := pem.Decode(bs)
+	if block == nil {
+		return mlkemParams{}, nil, fmt.Errorf("failed to decode public key PEM")
+	}
+	for _, params := range mlkemParamSets {
+		if block.Type == params.publicKeyPEMType() {
+			publicKey, err := params.newEncapsulationKey(block.Bytes)
+			if err != nil {
+				return mlkemParams{}, nil, fmt.Errorf("failed to parse public key: %v", err)
+			}
+			return params, publicKey, nil
+		}
+	}
+	return mlkemParams{}, nil, fmt.Errorf("public key is not an ML-KEM key: unexpected PEM type %q", block.Type)
+}
+
+func parseMLKEMPrivateKey(bs []byte) (mlkemParams, mlkemDecapsulationKey, error) {
+	block, _ := pem.Decode(bs)
+	if block == nil {
+		return mlkemParams{}, nil, fmt.Errorf("failed to decode private key PEM")
+	}
+	for _, params := range mlkemParamSets {
+		if block.Type == params.privateKeyPEMType() {
+			privateKey, err := params.newDecapsulationKey(block.Bytes)
+			if err != nil {
+				return mlkemParams{}, nil, fmt.Errorf("failed to parse private key: %v", err)
+			}
+			return params, privateKey, nil
+		}
+	}
+	return mlkemParams{}, nil, fmt.Errorf("private key is not an ML-KEM key: unexpected PEM type %q", block.Type)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func generateMLKEMKeys(t *testing.T, size, dir, prefix string) (privateKeyFilename, publicKeyFilename string) {
+	t.Helper()
+	privateKeyFilename = path.Join(dir, prefix+"priv.key")
+	publicKeyFilename = path.Join(dir, prefix+"pub.key")
+	if _, _, err := runRSACmd(t,
+		[]string{"mlkem", "generate", "--size", size, "--private-key", privateKeyFilename, "--public-key", publicKeyFilename},
+		""); err != nil {
+		t.Fatalf("ML-KEM-%v: keygen failed: %v", size, err)
+	}
+	return privateKeyFilename, publicKeyFilename
+}
+
+func TestMLKEMEncapsulateDecapsulate(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, eg := range []struct {
+		size           string
+		ciphertextSize int
+	}{
+		{"768", 1088},
+		{"1024", 1568},
+	} {
+		privateKeyFilename, publicKeyFilename := generateMLKEMKeys(t, eg.size, tempDir, eg.size+"-")
+		sharedKeyFilename := path.Join(tempDir, eg.size+"-shared.key")
+
+		ciphertext, _, err := runRSACmd(t,
+			[]string{"mlkem", "encapsulate", "--public-key", publicKeyFilename, "--shared-key", sharedKeyFilename}, "")
+		if err != nil {
+			t.Fatalf("ML-KEM-%v: encapsulate failed: %v", eg.size, err)
+		}
+		if len(ciphertext) != eg.ciphertextSize {
+			t.Fatalf("ML-KEM-%v: wanted a %v-byte ciphertext, got %v bytes", eg.size, eg.ciphertextSize, len(ciphertext))
+		}
+		sharedKey, err := os.ReadFile(sharedKeyFilename)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		decapsulated, _, err := runRSACmd(t, []string{"mlkem", "decapsulate", "--private-key", privateKeyFilename}, ciphertext)
+		if err != nil {
+			t.Fatalf("ML-KEM-%v: decapsulate failed: %v", eg.size, err)
+		}
+		if len(sharedKey) != 32 || decapsulated != string(sharedKey) {
+			t.Fatalf("ML-KEM-%v: wanted equal 32-byte shared keys, got %x and %x", eg.size, sharedKey, decapsulated)
+		}
+
+		// The extracted public key matches the generated one.
+		extracted, _, err := runRSACmd(t, []string{"mlkem", "extract", "--private-key", privateKeyFilename}, "")
+		if err != nil {
+			t.Fatalf("ML-KEM-%v: extract failed: %v", eg.size, err)
+		}
+		generated, err := os.ReadFile(publicKeyFilename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if extracted != string(generated) {
+			t.Fatalf("ML-KEM-%v: extracted public key differs from the generated one", eg.size)
+		}
+	}
+}
+
+func TestMLKEMHybridEndToEnd(t *testing.T) {
+	tempDir := t.TempDir()
+	x25519Private, x25519Public := generateECDHKeys(t, "x25519", tempDir, "x25519-")
+	otherX25519Private, _ := generateECDHKeys(t, "x25519", tempDir, "x25519-other-")
+	plaintext := "This is a test of hybrid ML-KEM encryption.\n"
+
+	for _, eg := range []struct {
+		size           string
+		ciphertextSize int
+	}{
+		{"768", 1088},
+		{"1024", 1568},
+	} {
+		privateKeyFilename, publicKeyFilename := generateMLKEMKeys(t, eg.size, tempDir, eg.size+"-")
+		otherPrivateKeyFilename, _ := generateMLKEMKeys(t, eg.size, tempDir, eg.size+"-other-")
+
+		ciphertext, _, err := runRSACmd(t,
+			[]string{"mlkem", "--public-key", publicKeyFilename, "--x25519-public-key", x25519Public}, plaintext)
+		if err != nil {
+			t.Fatalf("ML-KEM-%v: unexpected encryption error: %v", eg.size, err)
+		}
+		if want := eg.ciphertextSize + 32 + 12 + len(plaintext) + 16; len(ciphertext) != want {
+			t.Fatalf("ML-KEM-%v: wanted %v bytes, got %v", eg.size, want, len(ciphertext))
+		}
+
+		decryptArgs := []string{"mlkem", "--decrypt", "--key", privateKeyFilename, "--x25519-private-key", x25519Private}
+		decrypted, _, err := runRSACmd(t, decryptArgs, ciphertext)
+		if err != nil {
+			t.Fatalf("ML-KEM-%v: unexpected decryption error: %v", eg.size, err)
+		}
+		if decrypted != plaintext {
+			t.Fatalf("ML-KEM-%v: roundtrip failed: wanted %q, got %q", eg.size, plaintext, decrypted)
+		}
+
+		// Both private keys are needed, and tampering fails authentication.
+		for _, args := range [][]string{
+			{"mlkem", "--decrypt", "--private-key", otherPrivateKeyFilename, "--x25519-private-key", x25519Private},
+			{"mlkem", "--decrypt", "--private-key", privateKeyFilename, "--x25519-private-key", otherX25519Private},
+		} {
+			_, _, err := runRSACmd(t, args, ciphertext)
+			if err == nil || !strings.Contains(err.Error(), "message authentication failed") {
+				t.Fatalf("ML-KEM-%v: args=%#v: expected an authentication error, got %v", eg.size, args, err)
+			}
+		}
+		for _, offset := range []int{0, eg.ciphertextSize, len(ciphertext) - 1} {
+			tampered := []byte(ciphertext)
+			tampered[offset] ^= 0x01
+			if _, _, err := runRSACmd(t, decryptArgs, string(tampered)); err == nil {
+				t.Fatalf("ML-KEM-%v: expected an error for ciphertext tampered at offset %v, got nil", eg.size, offset)
+			}
+		}
+	}
+}
+
+func TestMLKEMErrors(t *testing.T) {
+	tempDir := t.TempDir()
+	privateKeyFilename, publicKeyFilename := generateMLKEMKeys(t, "768", tempDir, "")
+	_, x25519Public := generateECDHKeys(t, "x25519", tempDir, "x25519-")
+
+	for _, tc := range []struct {
+		args  []string
+		input string
+		err   string
+	}{
+		{[]string{"mlkem", "generate", "--size", "512"}, "", `invalid "--size" flag 512: must be one of 768, 1024`},
+		{[]string{"mlkem", "encapsulate", "--public-key", publicKeyFilename}, "",
+			`missing or invalid value for "--shared-key" flag ""`},
+		{[]string{"mlkem", "encapsulate", "--public-key", x25519Public, "--shared-key", path.Join(tempDir, "shared.key")}, "",
+			`public key is not an ML-KEM key: unexpected PEM type "PUBLIC KEY"`},
+		{[]string{"mlkem", "decapsulate", "--private-key", privateKeyFilename}, "short",
+			"invalid ML-KEM-768 ciphertext size 5 bytes, expected 1088"},
+		{[]string{"mlkem", "--public-key", publicKeyFilename}, "", `missing required "--x25519-public-key" flag`},
+		{[]string{"mlkem", "--decrypt", "--private-key", privateKeyFilename}, "", `missing required "--x25519-private-key" flag`},
+	} {
+		_, _, err := runRSACmd(t, tc.args, tc.input)
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Fatalf("args=%#v: expected error containing %q, got %v", tc.args, tc.err, err)
+		}
+	}
+}
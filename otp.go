@@ -2,11 +2,21 @@ package main
 
 import (
 	"crypto/rand"
+	"crypto/subtle"
 	"fmt"
 	"io"
 	"os"
 
 	"github.com/spf13/cobra"
+	"golang.org/x/crypto/poly1305"
+)
+
+const (
+	FlagNameAuthenticated = "authenticated"
+
+	// With --authenticated, the first otpMACKeyLen bytes of the pad are a
+	// one-time Poly1305 key, and the rest encrypts the message.
+	otpMACKeyLen = 32
 )
 
 func addOTPCommand(rootCmd *cobra.Command, o *Options) {
@@ -21,6 +31,12 @@ func addOTPCommand(rootCmd *cobra.Command, o *Options) {
 		Short:   short,
 		Args:    cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, _ []string) error {
+			if o.PadBook {
+				if o.Decode {
+					return otpBookDecrypt(cmd, o)
+				}
+				return otpBookEncrypt(cmd, o)
+			}
 			if o.Decode {
 				return otpDecrypt(cmd, o)
 			}
@@ -34,10 +50,57 @@ func addOTPCommand(rootCmd *cobra.Command, o *Options) {
 		"allow overwriting an existing pad file when encrypting (dangerous: reusing a pad destroys one-time-pad security)")
 	cmd.Flags().BoolVar(&o.DeletePad, "delete-pad", false,
 		"delete the pad file after a successful decrypt (reuse destroys one-time-pad security)")
-
+	cmd.Flags().BoolVar(&o.PadBook, FlagNamePadBook, false,
+		"use --pad as a pre-shared pad book, consumed from a tracked offset across messages")
+	cmd.Flags().StringVar(&o.PadStateFilename, FlagNamePadState, "",
+		`pad book state file tracking the next unused offset when encrypting (default "<pad>.state")`)
+	cmd.Flags().BoolVar(&o.PadAuthenticated, FlagNameAuthenticated, false,
+		"use 32 extra pad bytes as a one-time Poly1305 key and append a tag, which decryption verifies before writing any plaintext")
+
+	addOTPGenerateCmd(cmd, o)
 	rootCmd.AddCommand(cmd)
 }
 
+func addOTPGenerateCmd(otpCmd *cobra.Command, o *Options) {
+	var size int64
+
+	generateCmd := &cobra.Command{
+		Use:     "generate",
+		Aliases: []string{"gen"},
+		Short:   "Generate a standalone pad (or pad book) of random bytes",
+		Args:    cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			if err := checkPadFilename(o.PadFilename); err != nil {
+				return err
+			}
+			if size <= 0 {
+				return fmt.Errorf(`invalid "--size" value %v: must be a positive number of bytes`, size)
+			}
+			padFile, err := createPadFile(o.PadFilename, o.ForcePad)
+			if err != nil {
+				return err
+			}
+			if _, err := io.CopyN(padFile, rand.Reader, size); err != nil {
+				padFile.Close()
+				return fmt.Errorf("failed to write pad file: %v", err)
+			}
+			if err := padFile.Close(); err != nil {
+				return fmt.Errorf("failed to close pad file: %v", err)
+			}
+			return nil
+		},
+	}
+
+	generateCmd.Flags().StringVarP(&o.PadFilename, FlagNamePad, "p", "",
+		"pad file path to write (required)")
+	generateCmd.Flags().Int64VarP(&size, "size", "s", 0,
+		"pad size in bytes (required)")
+	generateCmd.Flags().BoolVar(&o.ForcePad, "force", false,
+		"allow overwriting an existing pad file (dangerous: reusing a pad destroys one-time-pad security)")
+
+	otpCmd.AddCommand(generateCmd)
+}
+
 func otpEncrypt(cmd *cobra.Command, o *Options) error {
 	if err := checkPadFilename(o.PadFilename); err != nil {
 		return err
@@ -48,19 +111,18 @@ func otpEncrypt(cmd *cobra.Command, o *Options) error {
 		return fmt.Errorf("failed to read plaintext: %v", err)
 	}
 
-	pad := make([]byte, len(plaintext))
+	padLen := len(plaintext)
+	if o.PadAuthenticated {
+		padLen += otpMACKeyLen
+	}
+	pad := make([]byte, padLen)
 	if _, err := io.ReadFull(rand.Reader, pad); err != nil {
 		return fmt.Errorf("failed to generate pad: %v", err)
 	}
 
-	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
-	if o.ForcePad {
-		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
-	}
-	padFile, err := os.OpenFile(o.PadFilename, flags, 0600)
+	padFile, err := createPadFile(o.PadFilename, o.ForcePad)
 	if err != nil {
-		return fmt.Errorf("failed to open pad file %q for writing (use --force to overwrite an existing pad, but reusing a pad destroys one-time-pad security): %v",
-			o.PadFilename, err)
+		return err
 	}
 	if _, err := padFile.Write(pad); err != nil {
 		padFile.Close()
@@ -70,7 +132,15 @@ func otpEncrypt(cmd *cobra.Command, o *Options) error {
 		return fmt.Errorf("failed to close pad file: %v", err)
 	}
 
-	if _, err := cmd.OutOrStdout().Write(xorBytes(plaintext, pad)); err != nil {
+	var ciphertext []byte
+	if o.PadAuthenticated {
+		macKey, pad := pad[:otpMACKeyLen], pad[otpMACKeyLen:]
+		ciphertext = xorBytes(plaintext, pad)
+		ciphertext = append(ciphertext, otpTag(macKey, ciphertext)...)
+	} else {
+		ciphertext = xorBytes(plaintext, pad)
+	}
+	if _, err := cmd.OutOrStdout().Write(ciphertext); err != nil {
 		return fmt.Errorf("failed to write ciphertext: %v", err)
 	}
 	return nil
@@ -97,7 +167,20 @@ func otpDecrypt(cmd *cobra.Command, o *Options) error {
 		return fmt.Errorf("failed to read pad file: %v", err)
 	}
 
-	if len(pad) != len(ciphertext) {
+	if o.PadAuthenticated {
+		if len(ciphertext) < poly1305.TagSize {
+			return fmt.Errorf("ciphertext too short: %v bytes, need at least %v for the tag", len(ciphertext), poly1305.TagSize)
+		}
+		if want := otpMACKeyLen + len(ciphertext) - poly1305.TagSize; len(pad) != want {
+			return fmt.Errorf("pad length (%v byte(s)) does not match the %v byte(s) this authenticated ciphertext needs", len(pad), want)
+		}
+		var macKey []byte
+		macKey, pad = pad[:otpMACKeyLen], pad[otpMACKeyLen:]
+		var err error
+		if ciphertext, err = otpOpen(macKey, ciphertext); err != nil {
+			return err
+		}
+	} else if len(pad) != len(ciphertext) {
 		return fmt.Errorf("pad length (%v byte(s)) does not match ciphertext length (%v byte(s))", len(pad), len(ciphertext))
 	}
 
@@ -113,6 +196,21 @@ func otpDecrypt(cmd *cobra.Command, o *Options) error {
 	return nil
 }
 
+// createPadFile creates a pad file, refusing to overwrite an existing one
+// unless force is set.
+func createPadFile(filename string, force bool) (*os.File, error) {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if force {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	padFile, err := os.OpenFile(filename, flags, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open pad file %q for writing (use --force to overwrite an existing pad, but reusing a pad destroys one-time-pad security): %v",
+			filename, err)
+	}
+	return padFile, nil
+}
+
 func checkPadFilename(filename string) error {
 	if filename == "" {
 		return fmt.Errorf(`missing required "--%v" flag`, FlagNamePad)
@@ -123,6 +221,26 @@ func checkPadFilename(filename string) error {
 	return nil
 }
 
+// otpTag returns the Poly1305 tag of data. Like the pad itself, a Poly1305
+// key must never be reused, and then forgeries are unlikely even for an
+// attacker with unlimited computing power.
+func otpTag(macKey, data []byte) []byte {
+	var key [32]byte
+	copy(key[:], macKey)
+	var tag [poly1305.TagSize]byte
+	poly1305.Sum(&tag, data, &key)
+	return tag[:]
+}
+
+// otpOpen verifies the tag at the end of data and returns the rest.
+func otpOpen(macKey, data []byte) ([]byte, error) {
+	data, tag := data[:len(data)-poly1305.TagSize], data[len(data)-poly1305.TagSize:]
+	if subtle.ConstantTimeCompare(otpTag(macKey, data), tag) != 1 {
+		return nil, fmt.Errorf("message authentication failed")
+	}
+	return data, nil
+}
+
 func xorBytes(data, pad []byte) []byte {
 	out := make([]byte, len(data))
 	for i := range data {
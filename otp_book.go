@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/poly1305"
+)
+
+const (
+	FlagNamePadBook  = "book"
+	FlagNamePadState = "state"
+
+	otpBookMagic   = "encotp"
+	otpBookVersion = 1
+	// otpBookVersionAuthenticated messages end with a Poly1305 tag over the
+	// header and ciphertext.
+	otpBookVersionAuthenticated = 2
+	// otpBookIDLen bytes at the start of a pad book identify it, and are
+	// never used as pad.
+	otpBookIDLen = 8
+	// otpBookHeaderLen is the magic, version, book ID and offset.
+	otpBookHeaderLen = len(otpBookMagic) + 1 + otpBookIDLen + 8
+)
+
+// A pad book is one large pre-shared pad (from "otp generate") consumed from
+// the front across many messages. Each ciphertext is the magic "encotp" ||
+// version (1) || book ID (8) || offset (8, big-endian) || plaintext XOR
+// pad[offset:offset+len(plaintext)], so the recipient needs no state of its
+// own. With --authenticated, the pad region starts with a one-time MAC key,
+// the version is 2, and a tag over the rest of the message is appended.
+// The sender's state file records the next unused offset; it is advanced
+// before any ciphertext is written, so no region is handed out twice even
+// if encryption is interrupted.
+type otpBookState struct {
+	BookID string `json:"bookId"`
+	Offset int64  `json:"offset"`
+}
+
+type otpBook struct {
+	file *os.File
+	id   []byte
+	size int64
+}
+
+func openOTPBook(filename string) (*otpBook, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open pad book: %v", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to stat pad book: %v", err)
+	}
+	id := make([]byte, otpBookIDLen)
+	if _, err := io.ReadFull(f, id); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("pad book %q is too short: %v", filename, err)
+	}
+	return &otpBook{file: f, id: id, size: info.Size()}, nil
+}
+
+// pad returns the n pad bytes at offset.
+func (b *otpBook) pad(offset, n int64) ([]byte, error) {
+	if offset < otpBookIDLen || offset > b.size || n > b.size-offset {
+		return nil, fmt.Errorf("pad book region [%v,%v) is out of range: the book holds %v byte(s)", offset, offset+n, b.size)
+	}
+	pad := make([]byte, n)
+	if _, err := b.file.ReadAt(pad, offset); err != nil {
+		return nil, fmt.Errorf("failed to read pad book: %v", err)
+	}
+	return pad, nil
+}
+
+func otpBookEncrypt(cmd *cobra.Command, o *Options) error {
+	if err := checkPadFilename(o.PadFilename); err != nil {
+		return err
+	}
+	if o.ForcePad {
+		log.Printf("WARNING: ignoring irrelevant %q flag for pad books", "--force")
+	}
+	stateFilename := o.PadStateFilename
+	if stateFilename == "" {
+		stateFilename = o.PadFilename + ".state"
+	}
+
+	plaintext, err := io.ReadAll(cmd.InOrStdin())
+	if err != nil {
+		return fmt.Errorf("failed to read plaintext: %v", err)
+	}
+
+	// Only one process at a time may take pad from the book.
+	lockFilename := stateFilename + ".lock"
+	lock, err := os.OpenFile(lockFilename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to lock pad book state (remove %q if no other encryption is running): %v", lockFilename, err)
+	}
+	lock.Close()
+	defer os.Remove(lockFilename)
+
+	book, err := openOTPBook(o.PadFilename)
+	if err != nil {
+		return err
+	}
+	defer book.file.Close()
+
+	state, err := readOTPBookState(stateFilename, book)
+	if err != nil {
+		return err
+	}
+	n := int64(len(plaintext))
+	version := byte(otpBookVersion)
+	if o.PadAuthenticated {
+		n += otpMACKeyLen
+		version = otpBookVersionAuthenticated
+	}
+	if remaining := book.size - state.Offset; n > remaining {
+		return fmt.Errorf("pad book %q has %v unused byte(s) left, need %v", o.PadFilename, remaining, n)
+	}
+	pad, err := book.pad(state.Offset, n)
+	if err != nil {
+		return err
+	}
+
+	offset := state.Offset
+	state.Offset += n
+	if err := writeOTPBookState(stateFilename, state); err != nil {
+		return err
+	}
+
+	header := make([]byte, 0, otpBookHeaderLen)
+	header = append(header, otpBookMagic...)
+	header = append(header, version)
+	header = append(header, book.id...)
+	header = binary.BigEndian.AppendUint64(header, uint64(offset))
+	var message []byte
+	if o.PadAuthenticated {
+		macKey, pad := pad[:otpMACKeyLen], pad[otpMACKeyLen:]
+		message = append(header, xorBytes(plaintext, pad)...)
+		message = append(message, otpTag(macKey, message)...)
+	} else {
+		message = append(header, xorBytes(plaintext, pad)...)
+	}
+	if _, err := cmd.OutOrStdout().Write(message); err != nil {
+		return fmt.Errorf("failed to write ciphertext: %v", err)
+	}
+	return nil
+}
+
+func otpBookDecrypt(cmd *cobra.Command, o *Options) error {
+	if err := checkPadFilename(o.PadFilename); err != nil {
+		return err
+	}
+	if o.DeletePad {
+		return fmt.Errorf(`the "--delete-pad" flag cannot be combined with "--%v": the rest of the book is still needed`, FlagNamePadBook)
+	}
+
+	message, err := io.ReadAll(cmd.InOrStdin())
+	if err != nil {
+		return fmt.Errorf("failed to read ciphertext: %v", err)
+	}
+	if len(message) < otpBookHeaderLen || !bytes.HasPrefix(message, []byte(otpBookMagic)) {
+		return fmt.Errorf("ciphertext is not a pad book message")
+	}
+	// The version must match the flag, so dropping the tag and downgrading
+	// the version doesn't get past --authenticated.
+	switch version := message[len(otpBookMagic)]; {
+	case version == otpBookVersion && o.PadAuthenticated:
+		return fmt.Errorf(`ciphertext is not authenticated, but the "--%v" flag requires it`, FlagNameAuthenticated)
+	case version == otpBookVersionAuthenticated && !o.PadAuthenticated:
+		return fmt.Errorf(`ciphertext is authenticated; decrypt it with the "--%v" flag`, FlagNameAuthenticated)
+	case version != otpBookVersion && version != otpBookVersionAuthenticated:
+		return fmt.Errorf("unsupported pad book message version %v", version)
+	}
+	id := message[len(otpBookMagic)+1 : len(otpBookMagic)+1+otpBookIDLen]
+	offset := binary.BigEndian.Uint64(message[otpBookHeaderLen-8 : otpBookHeaderLen])
+	n := int64(len(message) - otpBookHeaderLen)
+	if o.PadAuthenticated {
+		if n < poly1305.TagSize {
+			return fmt.Errorf("ciphertext too short: %v bytes, need at least %v for the tag", n, poly1305.TagSize)
+		}
+		n += otpMACKeyLen - poly1305.TagSize
+	}
+
+	book, err := openOTPBook(o.PadFilename)
+	if err != nil {
+		return err
+	}
+	defer book.file.Close()
+	if !bytes.Equal(id, book.id) {
+		return fmt.Errorf("ciphertext was encrypted with pad book %x, not %q (%x)", id, o.PadFilename, book.id)
+	}
+	if offset > uint64(book.size) {
+		return fmt.Errorf("pad book offset %v is out of range: the book holds %v byte(s)", offset, book.size)
+	}
+	pad, err := book.pad(int64(offset), n)
+	if err != nil {
+		return err
+	}
+	ciphertext := message[otpBookHeaderLen:]
+	if o.PadAuthenticated {
+		var macKey []byte
+		macKey, pad = pad[:otpMACKeyLen], pad[otpMACKeyLen:]
+		authenticated, err := otpOpen(macKey, message)
+		if err != nil {
+			return err
+		}
+		ciphertext = authenticated[otpBookHeaderLen:]
+	}
+
+	if _, err := cmd.OutOrStdout().Write(xorBytes(ciphertext, pad)); err != nil {
+		return fmt.Errorf("failed to write plaintext: %v", err)
+	}
+	return nil
+}
+
+// readOTPBookState reads the state of book, starting a new one at the first
+// usable offset if the state file doesn't exist yet.
+func readOTPBookState(filename string, book *otpBook) (*otpBookState, error) {
+	bs, err := os.ReadFile(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &otpBookState{BookID: hex.EncodeToString(book.id), Offset: otpBookIDLen}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pad book state: %v", err)
+	}
+	state := &otpBookState{}
+	if err := json.Unmarshal(bs, state); err != nil {
+		return nil, fmt.Errorf("failed to parse pad book state file %q: %v", filename, err)
+	}
+	if state.BookID != hex.EncodeToString(book.id) {
+		return nil, fmt.Errorf("pad book state file %q belongs to pad book %v, not %x", filename, state.BookID, book.id)
+	}
+	if state.Offset < otpBookIDLen || state.Offset > book.size {
+		return nil, fmt.Errorf("pad book state file %q has an invalid offset %v", filename, state.Offset)
+	}
+	return state, nil
+}
+
+// writeOTPBookState replaces the state file atomically, so an interrupted
+// write can't roll the offset back.
+func writeOTPBookState(filename string, state *otpBookState) error {
+	bs, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode pad book state: %v", err)
+	}
+	tmpFilename := filename + ".tmp"
+	if err := os.WriteFile(tmpFilename, append(bs, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to write pad book state: %v", err)
+	}
+	if err := os.Rename(tmpFilename, filename); err != nil {
+		os.Remove(tmpFilename)
+		return fmt.Errorf("failed to write pad book state: %v", err)
+	}
+	return nil
+}
@@ -191,3 +191,240 @@ func TestOTPDeletePadKeptOnFailure(t *testing.T) {
 		t.Fatalf("expected pad file to survive a failed decrypt, stat err=%v", err)
 	}
 }
+
+func TestOTPGenerate(t *testing.T) {
+	padFilename := path.Join(t.TempDir(), "otp.pad")
+	if _, _, err := runRSACmd(t, []string{"otp", "generate", "--size", "1000", "--pad", padFilename}, ""); err != nil {
+		t.Fatalf("unexpected generate error: %v", err)
+	}
+	pad, err := os.ReadFile(padFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pad) != 1000 {
+		t.Fatalf("wanted a 1000-byte pad, got %v bytes", len(pad))
+	}
+
+	// A generated pad of the right size decrypts like an XOR of the message.
+	message := []byte("Hello, pre-shared pad!")
+	shortPadFilename := path.Join(t.TempDir(), "short.pad")
+	mustWrite(t, shortPadFilename, pad[:len(message)])
+	plaintext, _, err := runRSACmd(t, []string{"otp", "--decrypt", "--pad", shortPadFilename}, string(xorBytes(message, pad)))
+	if err != nil {
+		t.Fatalf("unexpected decryption error: %v", err)
+	}
+	if plaintext != string(message) {
+		t.Fatalf("wanted %q, got %q", message, plaintext)
+	}
+
+	for _, tc := range []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"otp", "generate", "--size", "10", "--pad", padFilename}, "use --force to overwrite an existing pad"},
+		{[]string{"otp", "generate", "--size", "0", "--pad", padFilename}, `invalid "--size" value 0`},
+		{[]string{"otp", "generate", "--size", "10"}, `missing required "--pad" flag`},
+	} {
+		_, _, err := runRSACmd(t, tc.args, "")
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Fatalf("args=%#v: expected error containing %q, got %v", tc.args, tc.err, err)
+		}
+	}
+	if _, _, err := runRSACmd(t, []string{"otp", "generate", "--size", "10", "--pad", padFilename, "--force"}, ""); err != nil {
+		t.Fatalf("unexpected error with --force: %v", err)
+	}
+}
+
+func TestOTPBook(t *testing.T) {
+	tempDir := t.TempDir()
+	bookFilename := path.Join(tempDir, "book.pad")
+	if _, _, err := runRSACmd(t, []string{"otp", "generate", "--size", "64", "--pad", bookFilename}, ""); err != nil {
+		t.Fatalf("unexpected generate error: %v", err)
+	}
+	// The recipient has a copy of the book but no state.
+	recipientBookFilename := path.Join(tempDir, "recipient.pad")
+	book, err := os.ReadFile(bookFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustWrite(t, recipientBookFilename, book)
+
+	// Messages consume consecutive regions after the book ID, and decrypt in
+	// any order.
+	messages := []string{"first message", "second", "third message!"}
+	var ciphertexts []string
+	offset := otpBookIDLen
+	for _, message := range messages {
+		ciphertext, _, err := runRSACmd(t, []string{"otp", "--book", "--pad", bookFilename}, message)
+		if err != nil {
+			t.Fatalf("unexpected encryption error: %v", err)
+		}
+		if len(ciphertext) != otpBookHeaderLen+len(message) {
+			t.Fatalf("wanted %v bytes, got %v", otpBookHeaderLen+len(message), len(ciphertext))
+		}
+		want := string(xorBytes([]byte(message), book[offset:offset+len(message)]))
+		if ciphertext[otpBookHeaderLen:] != want {
+			t.Fatalf("message %q was not encrypted at offset %v", message, offset)
+		}
+		offset += len(message)
+		ciphertexts = append(ciphertexts, ciphertext)
+	}
+	for i := len(messages) - 1; i >= 0; i-- {
+		plaintext, _, err := runRSACmd(t, []string{"otp", "--decrypt", "--book", "--pad", recipientBookFilename}, ciphertexts[i])
+		if err != nil {
+			t.Fatalf("unexpected decryption error: %v", err)
+		}
+		if plaintext != messages[i] {
+			t.Fatalf("wanted %q, got %q", messages[i], plaintext)
+		}
+	}
+
+	// The book has 64 - 8 - 33 = 23 bytes left, and refuses to hand out more.
+	_, _, err = runRSACmd(t, []string{"otp", "--book", "--pad", bookFilename}, strings.Repeat("x", 24))
+	if err == nil || !strings.Contains(err.Error(), "has 23 unused byte(s) left, need 24") {
+		t.Fatalf("expected an exhausted book error, got %v", err)
+	}
+	if _, _, err := runRSACmd(t, []string{"otp", "--book", "--pad", bookFilename}, strings.Repeat("x", 23)); err != nil {
+		t.Fatalf("unexpected encryption error: %v", err)
+	}
+	state, err := os.ReadFile(bookFilename + ".state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(state), `"offset":64`) {
+		t.Fatalf("wanted the state at offset 64, got %s", state)
+	}
+}
+
+func TestOTPBookErrors(t *testing.T) {
+	tempDir := t.TempDir()
+	bookFilename := path.Join(tempDir, "book.pad")
+	mustWrite(t, bookFilename, mustRand(64))
+	otherBookFilename := path.Join(tempDir, "other.pad")
+	mustWrite(t, otherBookFilename, mustRand(64))
+	stateFilename := path.Join(tempDir, "custom.state")
+
+	ciphertext, _, err := runRSACmd(t, []string{"otp", "--book", "--pad", bookFilename, "--state", stateFilename}, "secret")
+	if err != nil {
+		t.Fatalf("unexpected encryption error: %v", err)
+	}
+	pastEnd := []byte(ciphertext)
+	pastEnd[otpBookHeaderLen-1] = 60
+
+	for _, tc := range []struct {
+		args  []string
+		input string
+		err   string
+	}{
+		{[]string{"otp", "--book", "--pad", otherBookFilename, "--state", stateFilename}, "secret",
+			"belongs to pad book"},
+		{[]string{"otp", "--decrypt", "--book", "--pad", otherBookFilename}, ciphertext,
+			"ciphertext was encrypted with pad book"},
+		{[]string{"otp", "--decrypt", "--book", "--pad", bookFilename}, string(pastEnd),
+			"pad book region [60,66) is out of range"},
+		{[]string{"otp", "--decrypt", "--book", "--pad", bookFilename}, "short", "ciphertext is not a pad book message"},
+		{[]string{"otp", "--decrypt", "--book", "--pad", bookFilename, "--delete-pad"}, ciphertext,
+			`the "--delete-pad" flag cannot be combined with "--book"`},
+	} {
+		_, _, err := runRSACmd(t, tc.args, tc.input)
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Fatalf("args=%#v: expected error containing %q, got %v", tc.args, tc.err, err)
+		}
+	}
+
+	// A leftover lock blocks encryption rather than risking a shared offset.
+	mustWrite(t, stateFilename+".lock", nil)
+	_, _, err = runRSACmd(t, []string{"otp", "--book", "--pad", bookFilename, "--state", stateFilename}, "secret")
+	if err == nil || !strings.Contains(err.Error(), "failed to lock pad book state") {
+		t.Fatalf("expected a lock error, got %v", err)
+	}
+}
+
+func TestOTPAuthenticated(t *testing.T) {
+	tempDir := t.TempDir()
+	padFilename := path.Join(tempDir, "otp.pad")
+	message := "Attack at dawn! 🔐"
+
+	ciphertext, _, err := runRSACmd(t, []string{"otp", "--authenticated", "--pad", padFilename}, message)
+	if err != nil {
+		t.Fatalf("unexpected encryption error: %v", err)
+	}
+	pad, err := os.ReadFile(padFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pad) != otpMACKeyLen+len(message) || len(ciphertext) != len(message)+16 {
+		t.Fatalf("wanted a %v-byte pad and %v-byte ciphertext, got %v and %v",
+			otpMACKeyLen+len(message), len(message)+16, len(pad), len(ciphertext))
+	}
+
+	decryptArgs := []string{"otp", "--decrypt", "--authenticated", "--pad", padFilename}
+	plaintext, _, err := runRSACmd(t, decryptArgs, ciphertext)
+	if err != nil {
+		t.Fatalf("unexpected decryption error: %v", err)
+	}
+	if plaintext != message {
+		t.Fatalf("wanted %q, got %q", message, plaintext)
+	}
+
+	// Flipping any bit is detected before any plaintext is written.
+	for offset := range len(ciphertext) {
+		tampered := []byte(ciphertext)
+		tampered[offset] ^= 0x80
+		plaintext, _, err := runRSACmd(t, decryptArgs, string(tampered))
+		if err == nil || !strings.Contains(err.Error(), "message authentication failed") {
+			t.Fatalf("offset %v: expected an authentication error, got %v", offset, err)
+		}
+		if strings.Contains(plaintext, "dawn") {
+			t.Fatalf("offset %v: wanted no plaintext, got %q", offset, plaintext)
+		}
+	}
+
+	_, _, err = runRSACmd(t, decryptArgs, ciphertext[:len(ciphertext)-1])
+	if err == nil || !strings.Contains(err.Error(), "pad length (52 byte(s)) does not match the 51 byte(s) this authenticated ciphertext needs") {
+		t.Fatalf("expected a pad length error, got %v", err)
+	}
+}
+
+func TestOTPBookAuthenticated(t *testing.T) {
+	bookFilename := path.Join(t.TempDir(), "book.pad")
+	mustWrite(t, bookFilename, mustRand(256))
+	message := "Attack at dawn! 🔐"
+
+	ciphertext, _, err := runRSACmd(t, []string{"otp", "--book", "--authenticated", "--pad", bookFilename}, message)
+	if err != nil {
+		t.Fatalf("unexpected encryption error: %v", err)
+	}
+	if len(ciphertext) != otpBookHeaderLen+len(message)+16 {
+		t.Fatalf("wanted %v bytes, got %v", otpBookHeaderLen+len(message)+16, len(ciphertext))
+	}
+	decryptArgs := []string{"otp", "--decrypt", "--book", "--authenticated", "--pad", bookFilename}
+	plaintext, _, err := runRSACmd(t, decryptArgs, ciphertext)
+	if err != nil {
+		t.Fatalf("unexpected decryption error: %v", err)
+	}
+	if plaintext != message {
+		t.Fatalf("wanted %q, got %q", message, plaintext)
+	}
+
+	// The header is authenticated too, and stripping the tag to pass the
+	// message off as unauthenticated is refused.
+	downgraded := []byte(ciphertext[:len(ciphertext)-16])
+	downgraded[len(otpBookMagic)] = otpBookVersion
+	for _, tc := range []struct {
+		args  []string
+		input string
+		err   string
+	}{
+		{decryptArgs, ciphertext[:otpBookHeaderLen] + "x" + ciphertext[otpBookHeaderLen+1:], "message authentication failed"},
+		{decryptArgs, string(downgraded), `ciphertext is not authenticated, but the "--authenticated" flag requires it`},
+		{[]string{"otp", "--decrypt", "--book", "--pad", bookFilename}, ciphertext,
+			`ciphertext is authenticated; decrypt it with the "--authenticated" flag`},
+		{decryptArgs, ciphertext[:otpBookHeaderLen+15], "ciphertext too short: 15 bytes, need at least 16 for the tag"},
+	} {
+		_, _, err := runRSACmd(t, tc.args, tc.input)
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Fatalf("args=%#v: expected error containing %q, got %v", tc.args, tc.err, err)
+		}
+	}
+}
@@ -1,12 +1,20 @@
 package padding
 
+import "errors"
+
+var (
+	ErrInvalidBlockSize    = errors.New("invalid PKCS#7 block size")
+	ErrInvalidPKCS7Padding = errors.New("invalid PKCS#7 padding")
+)
+
+// PadPKCS7 pads bs to a multiple of n bytes. A full block of padding is
+// appended when bs is already aligned, so the padding is always unambiguous.
 func PadPKCS7(bs []byte, n uint8) ([]byte, error) {
-	mod := len(bs) % int(n)
-	if mod == 0 {
-		return bs, nil
+	if n == 0 {
+		return nil, ErrInvalidBlockSize
 	}
 
-	diff := int(n) - mod
+	diff := int(n) - len(bs)%int(n)
 	padded := make([]byte, len(bs)+diff)
 	copy(padded, bs)
 	for i := diff; i > 0; i-- {
@@ -15,19 +23,21 @@ func PadPKCS7(bs []byte, n uint8) ([]byte, error) {
 	return padded, nil
 }
 
+// UnpadPKCS7 strips the padding added by PadPKCS7, returning
+// ErrInvalidPKCS7Padding if bs does not end in well-formed padding.
 func UnpadPKCS7(bs []byte) ([]byte, error) {
 	if len(bs) == 0 {
-		return bs, nil
+		return nil, ErrInvalidPKCS7Padding
 	}
 
 	paddingLen := int(bs[len(bs)-1])
 	if paddingLen == 0 || paddingLen > len(bs) {
-		return bs, nil
+		return nil, ErrInvalidPKCS7Padding
 	}
 
 	for i := len(bs) - paddingLen; i < len(bs); i++ {
 		if bs[i] != byte(paddingLen) {
-			return bs, nil
+			return nil, ErrInvalidPKCS7Padding
 		}
 	}
 
@@ -12,21 +12,21 @@ func TestPadPKCS7(t *testing.T) {
 		expected []byte
 		err      error
 	}{
-		{[]byte{}, 32, []byte{}, nil},
-		{[]byte{}, 16, []byte{}, nil},
-		{[]byte{}, 8, []byte{}, nil},
-		{[]byte{}, 4, []byte{}, nil},
+		{[]byte{}, 16, bytes.Repeat([]byte{16}, 16), nil},
+		{[]byte{}, 8, bytes.Repeat([]byte{8}, 8), nil},
+		{[]byte{}, 4, []byte("\x04\x04\x04\x04"), nil},
 		{[]byte("a"), 4, []byte("a\x03\x03\x03"), nil},
 		{[]byte("ab"), 4, []byte("ab\x02\x02"), nil},
 		{[]byte("abc"), 4, []byte("abc\x01"), nil},
-		{[]byte("abcd"), 4, []byte("abcd"), nil},
-		{[]byte("0000abcd"), 4, []byte("0000abcd"), nil},
+		{[]byte("abcd"), 4, []byte("abcd\x04\x04\x04\x04"), nil},
+		{[]byte("0000abcd"), 4, []byte("0000abcd\x04\x04\x04\x04"), nil},
 		{[]byte("0000abc"), 4, []byte("0000abc\x01"), nil},
 		{[]byte("0000ab"), 4, []byte("0000ab\x02\x02"), nil},
 		{[]byte("deadbeefx"), 8, []byte("deadbeefx\x07\x07\x07\x07\x07\x07\x07"), nil},
-		{[]byte("deadbeef"), 8, []byte("deadbeef"), nil},
+		{[]byte("deadbeef"), 8, []byte("deadbeef\x08\x08\x08\x08\x08\x08\x08\x08"), nil},
 		{[]byte("deadbee"), 8, []byte("deadbee\x01"), nil},
 		{[]byte("deadbe"), 8, []byte("deadbe\x02\x02"), nil},
+		{[]byte("abc"), 0, nil, ErrInvalidBlockSize},
 	} {
 		actual, actualErr := PadPKCS7(eg.input, eg.length)
 		if eg.err != nil {
@@ -49,17 +49,21 @@ func TestUnpadPKCS7(t *testing.T) {
 		expected []byte
 		err      error
 	}{
-		{[]byte{}, []byte{}, nil},
+		{[]byte("\x04\x04\x04\x04"), []byte{}, nil},
 		{[]byte("a\x03\x03\x03"), []byte("a"), nil},
 		{[]byte("ab\x02\x02"), []byte("ab"), nil},
 		{[]byte("abc\x01"), []byte("abc"), nil},
-		{[]byte("abcd"), []byte("abcd"), nil},
-		{[]byte("0000abcd"), []byte("0000abcd"), nil},
+		{[]byte("abcd\x04\x04\x04\x04"), []byte("abcd"), nil},
 		{[]byte("0000ab\x02\x02"), []byte("0000ab"), nil},
 		{[]byte("deadbeefx\x07\x07\x07\x07\x07\x07\x07"), []byte("deadbeefx"), nil},
-		{[]byte("deadbeef"), []byte("deadbeef"), nil},
 		{[]byte("deadbee\x01"), []byte("deadbee"), nil},
 		{[]byte("deadbe\x02\x02"), []byte("deadbe"), nil},
+		{[]byte{}, nil, ErrInvalidPKCS7Padding},
+		{[]byte("abcd"), nil, ErrInvalidPKCS7Padding},
+		{[]byte("deadbeef"), nil, ErrInvalidPKCS7Padding},
+		{[]byte("abc\x00"), nil, ErrInvalidPKCS7Padding},
+		{[]byte("ab\x01\x02"), nil, ErrInvalidPKCS7Padding},
+		{[]byte("\x05\x05\x05\x05"), nil, ErrInvalidPKCS7Padding},
 	} {
 		actual, actualErr := UnpadPKCS7(eg.input)
 		if eg.err != nil {
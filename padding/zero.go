@@ -0,0 +1,25 @@
+package padding
+
+import "bytes"
+
+// PadZero pads bs with zero bytes to a multiple of n bytes. Unlike PKCS#7,
+// nothing is appended when bs is already aligned.
+func PadZero(bs []byte, n uint8) ([]byte, error) {
+	if n == 0 {
+		return nil, ErrInvalidBlockSize
+	}
+
+	mod := len(bs) % int(n)
+	if mod == 0 {
+		return bs, nil
+	}
+	padded := make([]byte, len(bs)+int(n)-mod)
+	copy(padded, bs)
+	return padded, nil
+}
+
+// UnpadZero strips all trailing zero bytes, so it cannot restore input that
+// itself ended in zero bytes.
+func UnpadZero(bs []byte) ([]byte, error) {
+	return bytes.TrimRight(bs, "\x00"), nil
+}
@@ -0,0 +1,57 @@
+package padding
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPadZero(t *testing.T) {
+	for i, eg := range []struct {
+		input    []byte
+		length   uint8
+		expected []byte
+		err      error
+	}{
+		{[]byte{}, 4, []byte{}, nil},
+		{[]byte("a"), 4, []byte("a\x00\x00\x00"), nil},
+		{[]byte("abc"), 4, []byte("abc\x00"), nil},
+		{[]byte("abcd"), 4, []byte("abcd"), nil},
+		{[]byte("deadbeefx"), 8, []byte("deadbeefx\x00\x00\x00\x00\x00\x00\x00"), nil},
+		{[]byte("deadbeef"), 8, []byte("deadbeef"), nil},
+		{[]byte("abc"), 0, nil, ErrInvalidBlockSize},
+	} {
+		actual, actualErr := PadZero(eg.input, eg.length)
+		if eg.err != nil {
+			if actualErr == nil {
+				t.Fatalf("example %v\ngot no error but expected %q", i, eg.err.Error())
+			} else if eg.err.Error() != actualErr.Error() {
+				t.Fatalf("example %v\nunexpected error\nwanted %v\nactual %v", i, eg.err, actualErr)
+			}
+		} else if actualErr != nil {
+			t.Fatalf("example %v\nunexpected error %q", i, actualErr.Error())
+		} else if !bytes.Equal(actual, eg.expected) {
+			t.Fatalf("example %v\nunexpected output\nwanted %v\nactual %v", i, eg.expected, actual)
+		}
+	}
+}
+
+func TestUnpadZero(t *testing.T) {
+	for i, eg := range []struct {
+		input    []byte
+		expected []byte
+	}{
+		{[]byte{}, []byte{}},
+		{[]byte("a\x00\x00\x00"), []byte("a")},
+		{[]byte("abc\x00"), []byte("abc")},
+		{[]byte("abcd"), []byte("abcd")},
+		{[]byte("\x00\x00\x00\x00"), []byte{}},
+		{[]byte("a\x00b\x00"), []byte("a\x00b")},
+	} {
+		actual, err := UnpadZero(eg.input)
+		if err != nil {
+			t.Fatalf("example %v\nunexpected error %q", i, err.Error())
+		} else if !bytes.Equal(actual, eg.expected) {
+			t.Fatalf("example %v\nunexpected output\nwanted %v\nactual %v", i, eg.expected, actual)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"crypto/sha256"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -22,6 +23,10 @@ const (
 	EncryptedPrivateKeyPEMType = "ENCRYPTED PRIVATE KEY"
 )
 
+// errNotRSAPublicKey is returned for a public key of another type, such as
+// the X25519 or ML-KEM keys of other commands.
+var errNotRSAPublicKey = errors.New("public key is not an RSA key")
+
 var (
 	KeyEncodings             = []string{"der", "pem"}
 	PrivateKeyFormatHeadings = map[string]string{
@@ -41,21 +46,22 @@ func addRSACommands(rootCmd *cobra.Command, o *Options) {
 		Use:   "rsa",
 		Short: short,
 		Args:  cobra.NoArgs,
-		Run: func(cmd *cobra.Command, args []string) {
+		RunE: func(cmd *cobra.Command, args []string) error {
 			if o.Decode {
-				rsaDecrypt(cmd, o)
-				return
+				return rsaDecrypt(cmd, o)
 			}
-			rsaEncrypt(cmd, o)
+			return rsaEncrypt(cmd, o)
 		},
 	}
 
 	rsaCmd.Flags().StringVarP(&o.PrivateKeyFilename, FlagNamePrivateKey, "", "",
 		FilenameDescriptionPrivateKey+" filename")
-	rsaCmd.Flags().StringVarP(&o.PublicKeyFilename, FlagNamePublicKey, "", "",
-		FilenameDescriptionPublicKey+" filename")
+	rsaCmd.Flags().StringArrayVar(&o.PublicKeyFilenames, FlagNamePublicKey, nil,
+		FilenameDescriptionPublicKey+" filename; repeat to encrypt for several recipients (only RSA recipients are supported)")
 	rsaCmd.Flags().StringVarP(&o.KeyFilename, "key", "k", "",
 		"public or private key filename, depending on context")
+	rsaCmd.Flags().BoolVar(&o.RSADirect, FlagNameDirect, false,
+		"when encrypting, use RSA-OAEP on the input directly instead of wrapping an AES-256-GCM key (input limited to the key size minus 66 bytes)")
 
 	addGenerateCmd(rsaCmd)
 	addExtractPublicKeyCmd(rsaCmd)
@@ -64,83 +70,87 @@ func addRSACommands(rootCmd *cobra.Command, o *Options) {
 	rootCmd.AddCommand(rsaCmd)
 }
 
-func rsaDecrypt(cmd *cobra.Command, o *Options) {
+func rsaDecrypt(cmd *cobra.Command, o *Options) error {
 	// Warn the user if the public key argument was provided.
-	if o.PublicKeyFilename != "" {
+	if len(o.PublicKeyFilenames) > 0 {
 		log.Printf("WARNING: ignoring irrelevant %q flag", "--"+FlagNamePublicKey)
 	}
 
 	// Read and parse the private key.
-	privateKeyFilename := parseKeyFlagFrom(o, FlagNamePrivateKey, o.PrivateKeyFilename)
-	privateReader := fileReader(cmd, FilenameDescriptionPrivateKey, privateKeyFilename, false)
-	if privateReader == nil {
-		log.Fatalf("FATAL: missing or invalid value for %v flag %v=%q",
-			FilenameDescriptionPrivateKey, "--"+FlagNamePrivateKey, o.PrivateKeyFilename)
-	}
-	privateKeyBytes, err := io.ReadAll(privateReader)
+	privateKey, err := readRSAPrivateKey(cmd, o)
 	if err != nil {
-		log.Fatalf("FATAL: failed to read private key bytes: %v", err)
-	}
-	privateKeyPEM, _ := pem.Decode(privateKeyBytes)
-	privateKey, err := x509.ParsePKCS1PrivateKey(privateKeyPEM.Bytes)
-	if err != nil {
-		log.Fatalf("FATAL: failed to parse private key: %v", err)
+		return err
 	}
 
-	// Encrypt the data.
+	// Decrypt the data, detecting hybrid encryption by its header.
 	ciphertextReader := cmd.InOrStdin()
 	ciphertext, err := io.ReadAll(ciphertextReader)
 	if err != nil {
-		log.Fatalf("FATAL: failed to read ciphertext from stdin: %v", err)
+		return fmt.Errorf("failed to read ciphertext from stdin: %v", err)
 	}
-	plaintext, err := rsa.DecryptOAEP(sha256.New(), nil, privateKey, ciphertext, nil)
-	if err != nil {
-		log.Fatalf("FATAL: failed to decrypt: %v", err)
+	var plaintext []byte
+	if isRSAHybrid(ciphertext) {
+		plaintext, err = rsaHybridDecrypt(privateKey, ciphertext)
+		if err != nil {
+			return err
+		}
+	} else {
+		plaintext, err = rsa.DecryptOAEP(sha256.New(), nil, privateKey, ciphertext, nil)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt: %v", err)
+		}
 	}
 
 	// Write the plaintext.
 	plaintextFile := cmd.OutOrStdout()
-	plaintextFile.Write(plaintext)
+	if _, err := plaintextFile.Write(plaintext); err != nil {
+		return fmt.Errorf("failed to write plaintext: %v", err)
+	}
+	return nil
 }
 
-func rsaEncrypt(cmd *cobra.Command, o *Options) {
+func rsaEncrypt(cmd *cobra.Command, o *Options) error {
 	// Warn the user if the private key argument was provided.
 	if o.PrivateKeyFilename != "" {
 		log.Printf("WARNING: ignoring irrelevant %q flag", "--"+FlagNamePrivateKey)
 	}
 
-	// Read and parse the public key.
-	publicKeyFilename := parseKeyFlagFrom(o, FlagNamePublicKey, o.PublicKeyFilename)
-	publicReader := fileReader(cmd, FilenameDescriptionPublicKey, publicKeyFilename, false)
-	if publicReader == nil {
-		log.Fatalf("FATAL: missing or invalid value for %v flag %v=%q",
-			FilenameDescriptionPublicKey, "--"+FlagNamePublicKey, o.PublicKeyFilename)
-	}
-
-	publicKeyBytes, err := io.ReadAll(publicReader)
+	// Read and parse the public keys, one per recipient.
+	publicKeys, err := readRSAPublicKeys(cmd, o)
 	if err != nil {
-		log.Fatalf("FATAL: failed to read public key bytes: %v", err)
+		return err
 	}
-	publicKeyPEM, _ := pem.Decode(publicKeyBytes)
-	publicKey, err := x509.ParsePKCS1PublicKey(publicKeyPEM.Bytes)
-	if err != nil {
-		log.Fatalf("FATAL: failed to parse public key: %v", err)
+	if o.RSADirect && len(publicKeys) > 1 {
+		return fmt.Errorf(`the "--%v" flag supports a single "--%v" recipient`, FlagNameDirect, FlagNamePublicKey)
 	}
 
-	// Encrypt the data.
+	// Encrypt the data: by default with a random AES-256-GCM content key
+	// wrapped with RSA-OAEP, or directly with RSA-OAEP for "--direct",
+	// which limits the input to the key size minus 66 bytes.
 	plaintextReader := cmd.InOrStdin()
 	plaintext, err := io.ReadAll(plaintextReader)
 	if err != nil {
-		log.Fatalf("FATAL: failed to read plaintext from stdin: %v", err)
+		return fmt.Errorf("failed to read plaintext from stdin: %v", err)
 	}
-	ciphertext, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, plaintext, nil)
-	if err != nil {
-		log.Fatalf("FATAL: failed to encrypt: %v", err)
+	var ciphertext []byte
+	if o.RSADirect {
+		ciphertext, err = rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKeys[0], plaintext, nil)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt: %v", err)
+		}
+	} else {
+		ciphertext, err = rsaHybridEncrypt(publicKeys, plaintext)
+		if err != nil {
+			return err
+		}
 	}
 
 	// Write the ciphertext.
 	ciphertextFile := cmd.OutOrStdout()
-	ciphertextFile.Write(ciphertext)
+	if _, err := ciphertextFile.Write(ciphertext); err != nil {
+		return fmt.Errorf("failed to write ciphertext: %v", err)
+	}
+	return nil
 }
 
 func parseKeyFlagFrom(o *Options, flagName, flagValue string) string {
@@ -314,5 +324,40 @@ func readRSAPublicKey(cmd *cobra.Command, o *Options) (*rsa.PublicKey, error) {
 	if block == nil {
 		return nil, fmt.Errorf("failed to decode public key PEM")
 	}
+	if block.Type != RsaPublicKeyPEMType {
+		return nil, fmt.Errorf("%w: unexpected PEM type %q", errNotRSAPublicKey, block.Type)
+	}
 	return x509.ParsePKCS1PublicKey(block.Bytes)
 }
+
+// readRSAPublicKeys reads every repeated "--public-key" flag, or the single
+// public key given by "--key". Recipients can't mix key types: each must be
+// RSA.
+func readRSAPublicKeys(cmd *cobra.Command, o *Options) ([]*rsa.PublicKey, error) {
+	if len(o.PublicKeyFilenames) <= 1 {
+		if len(o.PublicKeyFilenames) == 1 {
+			o.PublicKeyFilename = o.PublicKeyFilenames[0]
+		}
+		publicKey, err := readRSAPublicKey(cmd, o)
+		if errors.Is(err, errNotRSAPublicKey) {
+			return nil, fmt.Errorf("%v: only RSA recipients are supported", err)
+		} else if err != nil {
+			return nil, err
+		}
+		return []*rsa.PublicKey{publicKey}, nil
+	}
+	if o.KeyFilename != "" {
+		return nil, fmt.Errorf(`the "--%v" flag cannot be combined with several "--%v" flags`, FlagNameKey, FlagNamePublicKey)
+	}
+	publicKeys := make([]*rsa.PublicKey, 0, len(o.PublicKeyFilenames))
+	for _, filename := range o.PublicKeyFilenames {
+		publicKey, err := readRSAPublicKey(cmd, &Options{PublicKeyFilename: filename})
+		if errors.Is(err, errNotRSAPublicKey) {
+			return nil, fmt.Errorf("%v: %v: only RSA recipients are supported", filename, err)
+		} else if err != nil {
+			return nil, fmt.Errorf("%v: %v", filename, err)
+		}
+		publicKeys = append(publicKeys, publicKey)
+	}
+	return publicKeys, nil
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+)
+
+const FlagNameDirect = "direct"
+
+// Hybrid RSA encryption, the default for "enc rsa", seals the input with a
+// random AES-256-GCM content key and wraps that key once per recipient, so
+// inputs of any size can be encrypted for any number of public keys:
+//
+//	magic "encrsa" (6 bytes) || version 1 (1 byte) ||
+//	recipient count (1 byte) || recipient stanzas ||
+//	nonce (12 bytes) || ciphertext || tag (16 bytes)
+//
+// where each recipient stanza is
+//
+//	key type (1 byte) || key ID (32 bytes) ||
+//	wrapped key length (2 bytes, big-endian) || wrapped key
+//
+// The only key type so far is RSA-OAEP-SHA256, and the key ID is the RFC
+// 7638 JWK thumbprint of the recipient's public key. Everything before the
+// nonce is authenticated as GCM additional data. "dec rsa" detects the magic,
+// and otherwise decrypts the input directly with RSA-OAEP as written by
+// "enc rsa --direct".
+var rsaHybridMagic = []byte("encrsa")
+
+const (
+	rsaHybridVersion = 1
+	rsaHybridKeySize = 32
+
+	rsaHybridKeyTypeRSAOAEP = 1
+	rsaHybridMaxRecipients  = 255
+)
+
+type rsaHybridRecipient struct {
+	keyType    byte
+	keyID      []byte
+	wrappedKey []byte
+}
+
+func rsaHybridEncrypt(publicKeys []*rsa.PublicKey, plaintext []byte) ([]byte, error) {
+	if len(publicKeys) > rsaHybridMaxRecipients {
+		return nil, fmt.Errorf("too many recipients: %v, at most %v are supported", len(publicKeys), rsaHybridMaxRecipients)
+	}
+	contentKey := make([]byte, rsaHybridKeySize)
+	if _, err := io.ReadFull(rand.Reader, contentKey); err != nil {
+		return nil, fmt.Errorf("failed to generate content key: %v", err)
+	}
+
+	header := append([]byte{}, rsaHybridMagic...)
+	header = append(header, rsaHybridVersion, byte(len(publicKeys)))
+	for i, publicKey := range publicKeys {
+		wrappedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, contentKey, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to wrap content key for recipient %v: %v", i+1, err)
+		}
+		header = append(header, rsaHybridKeyTypeRSAOAEP)
+		header = append(header, rsaKeyID(publicKey)...)
+		header = binary.BigEndian.AppendUint16(header, uint16(len(wrappedKey)))
+		header = append(header, wrappedKey...)
+	}
+
+	gcm, err := newRSAHybridGCM(contentKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce of size %v: %v", gcm.NonceSize(), err)
+	}
+	output := append(header, nonce...)
+	return gcm.Seal(output, nonce, plaintext, header), nil
+}
+
+func isRSAHybrid(ciphertext []byte) bool {
+	return bytes.HasPrefix(ciphertext, rsaHybridMagic)
+}
+
+// rsaHybridDecrypt tries the private key against each recipient stanza in
+// turn, and reports which one matched when there are several.
+func rsaHybridDecrypt(privateKey *rsa.PrivateKey, ciphertext []byte) ([]byte, error) {
+	header, recipients, err := parseRSAHybridHeader(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	rest := ciphertext[len(header):]
+
+	var contentKey []byte
+	for i, recipient := range recipients {
+		if recipient.keyType != rsaHybridKeyTypeRSAOAEP {
+			continue
+		}
+		contentKey, err = rsa.DecryptOAEP(sha256.New(), nil, privateKey, recipient.wrappedKey, nil)
+		if err != nil {
+			continue
+		}
+		if len(recipients) > 1 {
+			log.Printf("decrypting as recipient %v of %v (key ID %v)",
+				i+1, len(recipients), base64.RawURLEncoding.EncodeToString(recipient.keyID))
+		}
+		break
+	}
+	if contentKey == nil {
+		if len(recipients) == 1 {
+			return nil, fmt.Errorf("failed to unwrap content key (wrong private key?): %v", err)
+		}
+		return nil, fmt.Errorf("failed to unwrap content key: the private key matches none of the %v recipients", len(recipients))
+	}
+	// aes.NewCipher would also take a 16 or 24-byte key, silently
+	// decrypting with AES-128 or AES-192 under a format that promises AES-256.
+	if len(contentKey) != rsaHybridKeySize {
+		return nil, fmt.Errorf("invalid content key size %v bytes: must be %v", len(contentKey), rsaHybridKeySize)
+	}
+
+	gcm, err := newRSAHybridGCM(contentKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) < gcm.NonceSize()+gcm.Overhead() {
+		return nil, fmt.Errorf("hybrid ciphertext too short: %v bytes after the header, need at least %v for the nonce and tag",
+			len(rest), gcm.NonceSize()+gcm.Overhead())
+	}
+	plaintext, err := gcm.Open(nil, rest[:gcm.NonceSize()], rest[gcm.NonceSize():], header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt: %v", err)
+	}
+	return plaintext, nil
+}
+
+// parseRSAHybridHeader splits off the header, which is authenticated as a
+// whole, and decodes its recipient stanzas.
+func parseRSAHybridHeader(ciphertext []byte) ([]byte, []rsaHybridRecipient, error) {
+	tooShort := func(need int) error {
+		return fmt.Errorf("hybrid ciphertext too short: %v bytes, need at least %v for the header", len(ciphertext), need)
+	}
+	offset := len(rsaHybridMagic) + 1
+	if len(ciphertext) < offset+1 {
+		return nil, nil, tooShort(offset + 1)
+	}
+
+	if version := ciphertext[offset-1]; version != rsaHybridVersion {
+		return nil, nil, fmt.Errorf("unsupported hybrid RSA version %v", version)
+	}
+
+	count := int(ciphertext[offset])
+	offset++
+	if count == 0 {
+		return nil, nil, fmt.Errorf("hybrid ciphertext has no recipients")
+	}
+	recipients := make([]rsaHybridRecipient, 0, count)
+	for range count {
+		if len(ciphertext) < offset+1+sha256.Size+2 {
+			return nil, nil, tooShort(offset + 1 + sha256.Size + 2)
+		}
+		recipient := rsaHybridRecipient{
+			keyType: ciphertext[offset],
+			keyID:   ciphertext[offset+1 : offset+1+sha256.Size],
+		}
+		offset += 1 + sha256.Size
+		size := int(binary.BigEndian.Uint16(ciphertext[offset:]))
+		offset += 2
+		if len(ciphertext) < offset+size {
+			return nil, nil, tooShort(offset + size)
+		}
+		recipient.wrappedKey = ciphertext[offset : offset+size]
+		offset += size
+		recipients = append(recipients, recipient)
+	}
+	return ciphertext[:offset], recipients, nil
+}
+
+func newRSAHybridGCM(contentKey []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(contentKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AES cipher: %v", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize GCM AEAD mode: %v", err)
+	}
+	return gcm, nil
+}
+
+// rsaKeyID returns the RFC 7638 JWK thumbprint of an RSA public key, the
+// SHA-256 of its required JWK members in lexicographic order.
+func rsaKeyID(publicKey *rsa.PublicKey) []byte {
+	jwk, _ := json.Marshal(struct {
+		E   string `json:"e"`
+		Kty string `json:"kty"`
+		N   string `json:"n"`
+	}{
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+		Kty: "RSA",
+		N:   base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+	})
+	sum := sha256.Sum256(jwk)
+	return sum[:]
+}
@@ -2,10 +2,15 @@ package main
 
 import (
 	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/binary"
 	"fmt"
 	"log"
 	"math"
+	"os"
 	"path"
 	"reflect"
 	"regexp"
@@ -173,3 +178,176 @@ func mustDecodeBase64(s string) []byte {
 		return bs
 	}
 }
+
+func TestRsaHybridEncryption(t *testing.T) {
+	tempDir := t.TempDir()
+	privateKeyFilename := path.Join(tempDir, "priv.key")
+	publicKeyFilename := path.Join(tempDir, "pub.key")
+	otherPrivateKeyFilename := path.Join(tempDir, "other-priv.key")
+	for _, args := range [][]string{
+		{"rsa", "generate", "--private-key", privateKeyFilename, "--public-key", publicKeyFilename},
+		{"rsa", "generate", "--private-key", otherPrivateKeyFilename, "--public-key", path.Join(tempDir, "other-pub.key")},
+	} {
+		if _, _, err := runRSACmd(t, args, ""); err != nil {
+			t.Fatalf("keygen failed: %v", err)
+		}
+	}
+
+	// Far more than fits in a single RSA-OAEP block of a 2048-bit key.
+	plaintext := strings.Repeat("This is a test of hybrid RSA encryption.\n", 4096)
+	ciphertext, _, err := runRSACmd(t, []string{"rsa", "--public-key", publicKeyFilename}, plaintext)
+	if err != nil {
+		t.Fatalf("unexpected encryption error: %v", err)
+	}
+	if !strings.HasPrefix(ciphertext, string(rsaHybridMagic)) {
+		t.Fatalf("ciphertext is missing the hybrid header")
+	}
+	decrypted, _, err := runRSACmd(t, []string{"rsa", "--decrypt", "--private-key", privateKeyFilename}, ciphertext)
+	if err != nil {
+		t.Fatalf("unexpected decryption error: %v", err)
+	}
+	if decrypted != plaintext {
+		t.Fatalf("roundtrip failed: got %v bytes, wanted %v", len(decrypted), len(plaintext))
+	}
+
+	// Tampering with the payload or the header fails authentication, and
+	// another key can't unwrap the content key.
+	for _, offset := range []int{len(ciphertext) - 1, len(rsaHybridMagic) + 3} {
+		tampered := []byte(ciphertext)
+		tampered[offset] ^= 0x01
+		if _, _, err := runRSACmd(t, []string{"rsa", "--decrypt", "--private-key", privateKeyFilename}, string(tampered)); err == nil {
+			t.Fatalf("expected an error for ciphertext tampered at offset %v, got nil", offset)
+		}
+	}
+	_, _, err = runRSACmd(t, []string{"rsa", "--decrypt", "--private-key", otherPrivateKeyFilename}, ciphertext)
+	if err == nil || !strings.Contains(err.Error(), "failed to unwrap content key") {
+		t.Fatalf("expected an unwrap error for the wrong key, got %v", err)
+	}
+}
+
+// A content key that is not 32 bytes is rejected rather than used for
+// AES-128 or AES-192.
+func TestRsaHybridContentKeySize(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contentKey := mustRand(16)
+	wrappedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, &privateKey.PublicKey, contentKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := append([]byte{}, rsaHybridMagic...)
+	header = append(header, rsaHybridVersion, 1, rsaHybridKeyTypeRSAOAEP)
+	header = append(header, rsaKeyID(&privateKey.PublicKey)...)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(wrappedKey)))
+	header = append(header, wrappedKey...)
+	gcm, err := newRSAHybridGCM(contentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := mustRand(gcm.NonceSize())
+	ciphertext := gcm.Seal(append(header, nonce...), nonce, []byte("Hello, AES-128!"), header)
+
+	_, err = rsaHybridDecrypt(privateKey, ciphertext)
+	if err == nil || !strings.Contains(err.Error(), "invalid content key size 16 bytes: must be 32") {
+		t.Fatalf("expected a content key size error, got %v", err)
+	}
+}
+
+func TestRsaDirectEncryption(t *testing.T) {
+	tempDir := t.TempDir()
+	privateKeyFilename := path.Join(tempDir, "priv.key")
+	publicKeyFilename := path.Join(tempDir, "pub.key")
+	if _, _, err := runRSACmd(t,
+		[]string{"rsa", "generate", "--private-key", privateKeyFilename, "--public-key", publicKeyFilename}, ""); err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+
+	// "--direct" ciphertext is a single RSA-OAEP block, still decrypted
+	// without any flag.
+	plaintext := "This is a test of direct RSA encryption.\n"
+	ciphertext, _, err := runRSACmd(t, []string{"rsa", "--direct", "--public-key", publicKeyFilename}, plaintext)
+	if err != nil {
+		t.Fatalf("unexpected encryption error: %v", err)
+	}
+	if len(ciphertext) != 256 {
+		t.Fatalf("wanted a 256-byte RSA-OAEP block, got %v bytes", len(ciphertext))
+	}
+	decrypted, _, err := runRSACmd(t, []string{"rsa", "--decrypt", "--private-key", privateKeyFilename}, ciphertext)
+	if err != nil {
+		t.Fatalf("unexpected decryption error: %v", err)
+	}
+	if decrypted != plaintext {
+		t.Fatalf("roundtrip failed: wanted %q, got %q", plaintext, decrypted)
+	}
+
+	// 2048-bit RSA-OAEP-SHA256 fits at most 256-66 = 190 bytes.
+	_, _, err = runRSACmd(t, []string{"rsa", "--direct", "--public-key", publicKeyFilename}, strings.Repeat("x", 191))
+	if err == nil || !strings.Contains(err.Error(), "message too long") {
+		t.Fatalf("expected a message too long error, got %v", err)
+	}
+}
+
+func TestRsaMultipleRecipients(t *testing.T) {
+	tempDir := t.TempDir()
+	var privateKeyFilenames, publicKeyFilenames []string
+	for i := range 3 {
+		privateKeyFilename := path.Join(tempDir, fmt.Sprintf("priv%v.key", i))
+		publicKeyFilename := path.Join(tempDir, fmt.Sprintf("pub%v.key", i))
+		if _, _, err := runRSACmd(t,
+			[]string{"rsa", "generate", "--private-key", privateKeyFilename, "--public-key", publicKeyFilename}, ""); err != nil {
+			t.Fatalf("keygen failed: %v", err)
+		}
+		privateKeyFilenames = append(privateKeyFilenames, privateKeyFilename)
+		publicKeyFilenames = append(publicKeyFilenames, publicKeyFilename)
+	}
+
+	// Encrypt for the first two keys only.
+	plaintext := "This is a test of multi-recipient RSA encryption.\n"
+	ciphertext, _, err := runRSACmd(t,
+		[]string{"rsa", "--public-key", publicKeyFilenames[0], "--public-key", publicKeyFilenames[1]}, plaintext)
+	if err != nil {
+		t.Fatalf("unexpected encryption error: %v", err)
+	}
+
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+	for i, privateKeyFilename := range privateKeyFilenames[:2] {
+		logged.Reset()
+		decrypted, _, err := runRSACmd(t, []string{"rsa", "--decrypt", "--private-key", privateKeyFilename}, ciphertext)
+		if err != nil {
+			t.Fatalf("recipient %v: unexpected decryption error: %v", i+1, err)
+		}
+		if decrypted != plaintext {
+			t.Fatalf("recipient %v: roundtrip failed: wanted %q, got %q", i+1, plaintext, decrypted)
+		}
+		if want := fmt.Sprintf("recipient %v of 2", i+1); !strings.Contains(logged.String(), want) {
+			t.Fatalf("recipient %v: wanted log containing %q, got %q", i+1, want, logged.String())
+		}
+	}
+	_, _, err = runRSACmd(t, []string{"rsa", "--decrypt", "--private-key", privateKeyFilenames[2]}, ciphertext)
+	if err == nil || !strings.Contains(err.Error(), "matches none of the 2 recipients") {
+		t.Fatalf("expected an unwrap error for a non-recipient, got %v", err)
+	}
+
+	// Other key types can't be mixed in as recipients.
+	_, x25519PublicKeyFilename := generateECDHKeys(t, "x25519", tempDir, "x25519-")
+	for _, args := range [][]string{
+		{"rsa", "--public-key", publicKeyFilenames[0], "--public-key", x25519PublicKeyFilename},
+		{"rsa", "--public-key", x25519PublicKeyFilename},
+		{"jwe", "--alg", "RSA-OAEP-256", "--public-key", publicKeyFilenames[0], "--public-key", x25519PublicKeyFilename},
+	} {
+		_, _, err := runRSACmd(t, args, plaintext)
+		if err == nil || !strings.Contains(err.Error(), `unexpected PEM type "PUBLIC KEY": only RSA recipients are supported`) {
+			t.Fatalf("args=%#v: expected an RSA-only error, got %v", args, err)
+		}
+	}
+
+	_, _, err = runRSACmd(t,
+		[]string{"rsa", "--direct", "--public-key", publicKeyFilenames[0], "--public-key", publicKeyFilenames[1]}, plaintext)
+	if err == nil || !strings.Contains(err.Error(), `the "--direct" flag supports a single "--public-key" recipient`) {
+		t.Fatalf("expected a --direct error, got %v", err)
+	}
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	FlagNameThreshold = "threshold"
+	FlagNameShares    = "shares"
+	FlagNamePrefix    = "prefix"
+
+	shamirMagic    = "encshamir"
+	shamirVersion  = 1
+	shamirSetIDLen = 16
+	// shamirHeaderLen is the magic, version, threshold, index and set ID.
+	shamirHeaderLen = len(shamirMagic) + 3 + shamirSetIDLen
+)
+
+// addShamirCommand adds Shamir's secret sharing over GF(256): "enc shamir
+// split" turns the input into share files of which any threshold recover it
+// and fewer reveal nothing, and "dec shamir" recovers it from share files.
+//
+// Each share file is the magic "encshamir" || version (1) || threshold (1)
+// || index (1) || set ID (16) || share || SHA-256 checksum of everything
+// before it. The random set ID ties together the shares of one split. The
+// shared value is the secret followed by a SHA-256 of the set ID and
+// secret, so a combination of well-formed but mismatched shares is
+// detected without publishing anything about the secret in the clear.
+func addShamirCommand(rootCmd *cobra.Command, o *Options) {
+	var threshold int
+	var shares int
+	var prefix string
+	var force bool
+
+	short := "Split input into Shamir secret shares"
+	if o.Decode {
+		short = "Combine Shamir secret shares into the secret"
+	}
+
+	split := func(cmd *cobra.Command, _ []string) error {
+		return shamirSplit(cmd, threshold, shares, prefix, force)
+	}
+	combine := func(cmd *cobra.Command, args []string) error {
+		return shamirCombine(cmd, args)
+	}
+
+	shamirCmd := &cobra.Command{
+		Use:   "shamir [share files...]",
+		Short: short,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if o.Decode {
+				return cobra.MinimumNArgs(1)(cmd, args)
+			}
+			return cobra.NoArgs(cmd, args)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if o.Decode {
+				return combine(cmd, args)
+			}
+			return split(cmd, args)
+		},
+	}
+
+	shamirCmd.PersistentFlags().IntVar(&threshold, FlagNameThreshold, 0,
+		"number of shares needed to recover the secret (required when splitting)")
+	shamirCmd.PersistentFlags().IntVar(&shares, FlagNameShares, 0,
+		"number of shares to write, at most 255 (required when splitting)")
+	shamirCmd.PersistentFlags().StringVar(&prefix, FlagNamePrefix, "",
+		`share file path prefix: share i is written to "<prefix>.i" (required when splitting)`)
+	shamirCmd.PersistentFlags().BoolVar(&force, "force", false,
+		"allow overwriting existing share files when splitting")
+
+	shamirCmd.AddCommand(&cobra.Command{
+		Use:   "split",
+		Short: "Split input into Shamir secret shares",
+		Args:  cobra.NoArgs,
+		RunE:  split,
+	})
+	shamirCmd.AddCommand(&cobra.Command{
+		Use:     "combine share-file...",
+		Aliases: []string{"join"},
+		Short:   "Combine Shamir secret shares into the secret",
+		Args:    cobra.MinimumNArgs(1),
+		RunE:    combine,
+	})
+
+	rootCmd.AddCommand(shamirCmd)
+}
+
+type shamirShare struct {
+	filename  string
+	threshold byte
+	index     byte
+	setID     []byte
+	payload   []byte
+}
+
+func shamirSplit(cmd *cobra.Command, threshold, shares int, prefix string, force bool) error {
+	if shares < 2 || shares > 255 {
+		return fmt.Errorf(`invalid "--%v" value %v: must be in range [2,255]`, FlagNameShares, shares)
+	}
+	if threshold < 2 || threshold > shares {
+		return fmt.Errorf(`invalid "--%v" value %v: must be in range [2,%v]`, FlagNameThreshold, threshold, shares)
+	}
+	if prefix == "" {
+		return fmt.Errorf(`missing required "--%v" flag`, FlagNamePrefix)
+	}
+	if prefix == "-" {
+		return fmt.Errorf(`the "--%v" flag does not support "-" (stdout); provide a file path prefix`, FlagNamePrefix)
+	}
+
+	secret, err := io.ReadAll(cmd.InOrStdin())
+	if err != nil {
+		return fmt.Errorf("failed to read secret: %v", err)
+	}
+	if len(secret) == 0 {
+		return fmt.Errorf("refusing to split an empty secret")
+	}
+
+	setID := make([]byte, shamirSetIDLen)
+	if _, err := io.ReadFull(rand.Reader, setID); err != nil {
+		return fmt.Errorf("failed to generate set ID: %v", err)
+	}
+	payloads, err := shamirSplitBytes(shamirPayload(setID, secret), threshold, shares)
+	if err != nil {
+		return err
+	}
+
+	// Check every share file before writing any of them, write the shares
+	// to temporary files next to them, and only move those into place once
+	// all are written, so a failure neither leaves a partial set behind nor,
+	// with --force, truncates or removes an existing one.
+	filenames := make([]string, shares)
+	for i := range filenames {
+		filenames[i] = fmt.Sprintf("%v.%v", prefix, i+1)
+		info, err := os.Lstat(filenames[i])
+		if err == nil && !force {
+			return fmt.Errorf("share file %q already exists (use --force to overwrite existing shares)", filenames[i])
+		} else if err == nil && !info.Mode().IsRegular() {
+			return fmt.Errorf("share file %q exists and is not a regular file", filenames[i])
+		} else if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to check share file %q: %v", filenames[i], err)
+		}
+	}
+	tmpFilenames := make([]string, 0, shares)
+	cleanup := func() {
+		for _, tmpFilename := range tmpFilenames {
+			os.Remove(tmpFilename)
+		}
+	}
+	for i, filename := range filenames {
+		f, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*.tmp")
+		if err != nil {
+			cleanup()
+			return fmt.Errorf("failed to create share file %q: %v", filename, err)
+		}
+		tmpFilenames = append(tmpFilenames, f.Name())
+		share := shamirShare{threshold: byte(threshold), index: byte(i + 1), setID: setID, payload: payloads[i]}
+		_, err = f.Write(share.marshal())
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			cleanup()
+			return fmt.Errorf("failed to write share file %q: %v", filename, err)
+		}
+	}
+	for i, tmpFilename := range tmpFilenames {
+		if err := os.Rename(tmpFilename, filenames[i]); err != nil {
+			cleanup()
+			return fmt.Errorf("failed to write share file %q: %v", filenames[i], err)
+		}
+	}
+	return nil
+}
+
+func shamirCombine(cmd *cobra.Command, filenames []string) error {
+	var shares []*shamirShare
+	for _, filename := range filenames {
+		if isStd(filename) {
+			return fmt.Errorf(`share files do not support "-" (stdin); provide a file path`)
+		}
+		bs, err := os.ReadFile(filename)
+		if err != nil {
+			return fmt.Errorf("failed to read share file: %v", err)
+		}
+		share, err := parseShamirShare(bs)
+		if err != nil {
+			return fmt.Errorf("invalid share file %q: %v", filename, err)
+		}
+		share.filename = filename
+		shares = append(shares, share)
+	}
+
+	first := shares[0]
+	seen := map[byte]string{}
+	for _, share := range shares {
+		if !bytes.Equal(share.setID, first.setID) || share.threshold != first.threshold ||
+			len(share.payload) != len(first.payload) {
+			return fmt.Errorf("share files %q and %q are not from the same split", first.filename, share.filename)
+		}
+		if other, ok := seen[share.index]; ok {
+			return fmt.Errorf("share files %q and %q both hold share %v", other, share.filename, share.index)
+		}
+		seen[share.index] = share.filename
+	}
+	if len(shares) < int(first.threshold) {
+		return fmt.Errorf("need %v shares to recover the secret, got %v", first.threshold, len(shares))
+	}
+
+	// Interpolate from the first threshold shares, and check that any
+	// others lie on the same polynomial.
+	basis := shares[:first.threshold]
+	payload := shamirInterpolate(basis, 0)
+	for _, share := range shares[first.threshold:] {
+		if subtle.ConstantTimeCompare(shamirInterpolate(basis, share.index), share.payload) != 1 {
+			return fmt.Errorf("share files are inconsistent: share %v (%q) disagrees with the others", share.index, share.filename)
+		}
+	}
+
+	secret := payload[:len(payload)-sha256.Size]
+	if subtle.ConstantTimeCompare(shamirPayload(first.setID, secret), payload) != 1 {
+		return fmt.Errorf("share files are inconsistent: the recovered secret fails its checksum")
+	}
+
+	if _, err := cmd.OutOrStdout().Write(secret); err != nil {
+		return fmt.Errorf("failed to write secret: %v", err)
+	}
+	return nil
+}
+
+// shamirPayload returns the secret followed by its checksum.
+func shamirPayload(setID, secret []byte) []byte {
+	h := sha256.New()
+	h.Write(setID)
+	h.Write(secret)
+	return h.Sum(append([]byte(nil), secret...))
+}
+
+func (s *shamirShare) marshal() []byte {
+	bs := make([]byte, 0, shamirHeaderLen+len(s.payload)+sha256.Size)
+	bs = append(bs, shamirMagic...)
+	bs = append(bs, shamirVersion, s.threshold, s.index)
+	bs = append(bs, s.setID...)
+	bs = append(bs, s.payload...)
+	sum := sha256.Sum256(bs)
+	return append(bs, sum[:]...)
+}
+
+func parseShamirShare(bs []byte) (*shamirShare, error) {
+	if len(bs) < shamirHeaderLen+2*sha256.Size+1 || !bytes.HasPrefix(bs, []byte(shamirMagic)) {
+		return nil, fmt.Errorf("not a share file")
+	}
+	body, sum := bs[:len(bs)-sha256.Size], bs[len(bs)-sha256.Size:]
+	if want := sha256.Sum256(body); subtle.ConstantTimeCompare(want[:], sum) != 1 {
+		return nil, fmt.Errorf("checksum mismatch (corrupted share?)")
+	}
+	header := body[len(shamirMagic):]
+	if header[0] != shamirVersion {
+		return nil, fmt.Errorf("unsupported version %v", header[0])
+	}
+	share := &shamirShare{
+		threshold: header[1],
+		index:     header[2],
+		setID:     header[3 : 3+shamirSetIDLen],
+		payload:   body[shamirHeaderLen:],
+	}
+	if share.threshold < 2 || share.index == 0 {
+		return nil, fmt.Errorf("invalid threshold %v or index %v", share.threshold, share.index)
+	}
+	return share, nil
+}
+
+// shamirSplitBytes splits each byte of secret with its own random
+// polynomial of degree threshold-1, and returns the values at x = 1..shares.
+func shamirSplitBytes(secret []byte, threshold, shares int) ([][]byte, error) {
+	coefficients := make([]byte, (threshold-1)*len(secret))
+	if _, err := io.ReadFull(rand.Reader, coefficients); err != nil {
+		return nil, fmt.Errorf("failed to generate polynomial: %v", err)
+	}
+	payloads := make([][]byte, shares)
+	for i := range payloads {
+		x := byte(i + 1)
+		payloads[i] = make([]byte, len(secret))
+		for j, s := range secret {
+			// Horner's rule, from the highest coefficient down to the secret.
+			var y byte
+			for k := threshold - 2; k >= 0; k-- {
+				y = gf256Mul(y, x) ^ coefficients[k*len(secret)+j]
+			}
+			payloads[i][j] = gf256Mul(y, x) ^ s
+		}
+	}
+	return payloads, nil
+}
+
+// shamirInterpolate evaluates the polynomial through the given shares at x
+// with Lagrange interpolation.
+func shamirInterpolate(shares []*shamirShare, x byte) []byte {
+	out := make([]byte, len(shares[0].payload))
+	for i, si := range shares {
+		// The basis polynomial: the product of (x - xj) / (xi - xj) for
+		// j != i, where subtraction in GF(256) is XOR.
+		basis := byte(1)
+		for j, sj := range shares {
+			if i != j {
+				basis = gf256Mul(basis, gf256Mul(x^sj.index, gf256Inv(si.index^sj.index)))
+			}
+		}
+		for k, y := range si.payload {
+			out[k] ^= gf256Mul(basis, y)
+		}
+	}
+	return out
+}
+
+// gf256Mul multiplies in GF(2^8) modulo the AES polynomial x^8 + x^4 + x^3
+// + x + 1, without data-dependent branches or table lookups.
+func gf256Mul(a, b byte) byte {
+	var p byte
+	for range 8 {
+		p ^= a & -(b & 1)
+		a = a<<1 ^ 0x1b&-(a>>7)
+		b >>= 1
+	}
+	return p
+}
+
+// gf256Inv returns the multiplicative inverse a^254, or 0 for 0.
+func gf256Inv(a byte) byte {
+	result := byte(1)
+	for range 7 {
+		a = gf256Mul(a, a)
+		result = gf256Mul(result, a)
+	}
+	return result
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"crypto"
+	"crypto/hmac"
+	_ "crypto/sha1" // Registers crypto.SHA1, the default for one-time passwords.
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	FlagNameDigits  = "digits"
+	FlagNamePeriod  = "period"
+	FlagNameCounter = "counter"
+	FlagNameTime    = "time"
+	FlagNameCode    = "code"
+	FlagNameSkew    = "skew"
+	FlagNameWindow  = "window"
+)
+
+var otpCodeHashAlgorithms = map[string]crypto.Hash{
+	"sha1":   crypto.SHA1,
+	"sha256": crypto.SHA256,
+	"sha512": crypto.SHA512,
+}
+
+var otpCodeHashNames = []string{"sha1", "sha256", "sha512"}
+
+// otpCodeParams are the parameters of a TOTP or HOTP generator, from flags
+// or an otpauth:// URI.
+type otpCodeParams struct {
+	secret   []byte
+	hashName string
+	digits   int
+	period   int
+	counter  uint64
+}
+
+// addOTPCodeCommands adds one-time password generation and verification:
+// "hotp" (RFC 4226), counter-based, and "totp" (RFC 6238), where the
+// counter is the number of periods since the Unix epoch. The input is a
+// base32 secret or an otpauth:// URI ("Key Uri Format") as shown in QR codes.
+func addOTPCodeCommands(rootCmd *cobra.Command) {
+	addOTPCodeCommand(rootCmd, "totp", "Generate a time-based one-time password (TOTP) from an input secret")
+	addOTPCodeCommand(rootCmd, "hotp", "Generate a counter-based one-time password (HOTP) from an input secret")
+}
+
+func addOTPCodeCommand(rootCmd *cobra.Command, kind, short string) {
+	params := &otpCodeParams{}
+	var timeString string
+	var code string
+	var skew int
+	var window int
+
+	codeCmd := &cobra.Command{
+		Use:   kind,
+		Short: short,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if err := readOTPCodeParams(cmd, kind, params); err != nil {
+				return err
+			}
+			counter := params.counter
+			if kind == "totp" {
+				var err error
+				if counter, err = totpCounter(params, timeString); err != nil {
+					return err
+				}
+			}
+			if _, err := fmt.Fprintln(cmd.OutOrStdout(), otpCode(params, counter)); err != nil {
+				return fmt.Errorf("failed to write code: %v", err)
+			}
+			return nil
+		},
+	}
+
+	codeCmd.PersistentFlags().StringVarP(&params.hashName, FlagNameHash, "a", "sha1",
+		"HMAC hash algorithm: "+strings.Join(otpCodeHashNames, ", "))
+	codeCmd.PersistentFlags().IntVar(&params.digits, FlagNameDigits, 6,
+		"number of digits in a code, 6 to 8")
+	if kind == "totp" {
+		codeCmd.PersistentFlags().IntVar(&params.period, FlagNamePeriod, 30,
+			"time step in seconds")
+		codeCmd.PersistentFlags().StringVar(&timeString, FlagNameTime, "",
+			"RFC 3339 time to generate or verify a code for (default now)")
+	} else {
+		codeCmd.PersistentFlags().Uint64Var(&params.counter, FlagNameCounter, 0,
+			"counter value to generate or verify a code for")
+	}
+
+	verifyCmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Verify a one-time password",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if code == "" {
+				return fmt.Errorf(`missing required "--%v" flag`, FlagNameCode)
+			}
+			if err := readOTPCodeParams(cmd, kind, params); err != nil {
+				return err
+			}
+
+			if kind == "hotp" {
+				if window < 0 {
+					return fmt.Errorf(`invalid "--%v" value %v: must not be negative`, FlagNameWindow, window)
+				}
+				for i := 0; i <= window; i++ {
+					if otpCodeEqual(otpCode(params, params.counter+uint64(i)), code) {
+						// The next counter to expect, for the caller to store.
+						if _, err := fmt.Fprintln(cmd.OutOrStdout(), params.counter+uint64(i)+1); err != nil {
+							return fmt.Errorf("failed to write counter: %v", err)
+						}
+						return nil
+					}
+				}
+				return fmt.Errorf("invalid code for counters %v to %v", params.counter, params.counter+uint64(window))
+			}
+
+			if skew < 0 {
+				return fmt.Errorf(`invalid "--%v" value %v: must not be negative`, FlagNameSkew, skew)
+			}
+			counter, err := totpCounter(params, timeString)
+			if err != nil {
+				return err
+			}
+			for i := -skew; i <= skew; i++ {
+				if (i < 0 && counter < uint64(-i)) || !otpCodeEqual(otpCode(params, counter+uint64(i)), code) {
+					continue
+				}
+				if i != 0 {
+					log.Printf("WARNING: code matched %v time step(s) away; check the clocks", i)
+				}
+				return nil
+			}
+			return fmt.Errorf("invalid code within %v time step(s) of %v", skew,
+				time.Unix(int64(counter)*int64(params.period), 0).UTC().Format(time.RFC3339))
+		},
+	}
+
+	verifyCmd.Flags().StringVar(&code, FlagNameCode, "",
+		"the code to verify (required)")
+	if kind == "totp" {
+		verifyCmd.Flags().IntVar(&skew, FlagNameSkew, 1,
+			"accept codes up to this many time steps before or after the current one")
+	} else {
+		verifyCmd.Flags().IntVar(&window, FlagNameWindow, 0,
+			"accept codes up to this many counter values after the current one")
+	}
+
+	codeCmd.AddCommand(verifyCmd)
+	rootCmd.AddCommand(codeCmd)
+}
+
+// readOTPCodeParams reads the secret from the input. An otpauth:// URI sets
+// any parameters not given explicitly by flags.
+func readOTPCodeParams(cmd *cobra.Command, kind string, params *otpCodeParams) error {
+	input, err := io.ReadAll(cmd.InOrStdin())
+	if err != nil {
+		return fmt.Errorf("failed to read secret: %v", err)
+	}
+	secret := strings.TrimSpace(string(input))
+
+	if strings.HasPrefix(secret, "otpauth://") {
+		u, err := url.Parse(secret)
+		if err != nil {
+			return fmt.Errorf("invalid otpauth URI: %v", err)
+		}
+		if !strings.EqualFold(u.Host, kind) {
+			return fmt.Errorf("otpauth URI is for %q, not %q", u.Host, kind)
+		}
+		query := u.Query()
+		secret = query.Get("secret")
+		if secret == "" {
+			return fmt.Errorf(`otpauth URI has no "secret" parameter`)
+		}
+		for _, p := range []struct {
+			name, flagName string
+			set            func(string) error
+		}{
+			{"algorithm", FlagNameHash, func(s string) error { params.hashName = strings.ToLower(s); return nil }},
+			{"digits", FlagNameDigits, func(s string) (err error) { params.digits, err = strconv.Atoi(s); return err }},
+			{"period", FlagNamePeriod, func(s string) (err error) { params.period, err = strconv.Atoi(s); return err }},
+			{"counter", FlagNameCounter, func(s string) (err error) { params.counter, err = strconv.ParseUint(s, 10, 64); return err }},
+		} {
+			value := query.Get(p.name)
+			if value == "" || cmd.Flags().Changed(p.flagName) {
+				continue
+			}
+			if err := p.set(value); err != nil {
+				return fmt.Errorf("invalid otpauth URI %q parameter %q: %v", p.name, value, err)
+			}
+		}
+	}
+
+	if _, ok := otpCodeHashAlgorithms[params.hashName]; !ok {
+		return fmt.Errorf("invalid %q flag %q: must be one of %v",
+			"--"+FlagNameHash, params.hashName, strings.Join(otpCodeHashNames, ", "))
+	}
+	if params.digits < 6 || params.digits > 8 {
+		return fmt.Errorf(`invalid "--%v" value %v: must be in range [6,8]`, FlagNameDigits, params.digits)
+	}
+	if kind == "totp" && params.period <= 0 {
+		return fmt.Errorf(`invalid "--%v" value %v: must be positive`, FlagNamePeriod, params.period)
+	}
+
+	// The same decoder as the base32 codec, accepting the lowercase,
+	// spaced and unpadded forms secrets are usually shown in.
+	secret = strings.TrimRight(strings.ToUpper(secret), "=")
+	decoder := base32.NewDecoder(base32.StdEncoding.WithPadding(base32.NoPadding),
+		WhitespaceIgnoringReader{strings.NewReader(secret)})
+	if params.secret, err = io.ReadAll(decoder); err != nil {
+		return fmt.Errorf("invalid base32 secret: %v", err)
+	}
+	if len(params.secret) == 0 {
+		return fmt.Errorf("missing secret: provide a base32 secret or an otpauth:// URI as input")
+	}
+	return nil
+}
+
+func totpCounter(params *otpCodeParams, timeString string) (uint64, error) {
+	now := time.Now()
+	if timeString != "" {
+		var err error
+		if now, err = time.Parse(time.RFC3339, timeString); err != nil {
+			return 0, fmt.Errorf(`invalid "--%v" value %q: %v`, FlagNameTime, timeString, err)
+		}
+	}
+	if now.Unix() < 0 {
+		return 0, fmt.Errorf(`invalid "--%v" value %q: must not be before the Unix epoch`, FlagNameTime, timeString)
+	}
+	return uint64(now.Unix()) / uint64(params.period), nil
+}
+
+// otpCode returns the HOTP value of counter, with the dynamic truncation of
+// RFC 4226, section 5.3.
+func otpCode(params *otpCodeParams, counter uint64) string {
+	mac := hmac.New(otpCodeHashAlgorithms[params.hashName].New, params.secret)
+	mac.Write(binary.BigEndian.AppendUint64(nil, counter))
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff
+	modulus := uint32(1)
+	for range params.digits {
+		modulus *= 10
+	}
+	return fmt.Sprintf("%0*d", params.digits, value%modulus)
+}
+
+func otpCodeEqual(want, got string) bool {
+	return subtle.ConstantTimeCompare([]byte(want), []byte(strings.TrimSpace(got))) == 1
+}
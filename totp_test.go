@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base32"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	otpCodeSHA1Secret   = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	otpCodeSHA256Secret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890123456789012"))
+	otpCodeSHA512Secret = base32.StdEncoding.EncodeToString([]byte(strings.Repeat("1234567890", 6) + "1234"))
+)
+
+// RFC 4226, appendix D.
+func TestHOTPKnownAnswers(t *testing.T) {
+	for counter, want := range []string{
+		"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489",
+	} {
+		code, _, err := runRSACmd(t, []string{"hotp", "--counter", fmt.Sprint(counter)}, otpCodeSHA1Secret)
+		if err != nil {
+			t.Fatalf("counter %v: unexpected error: %v", counter, err)
+		}
+		if code != want+"\n" {
+			t.Fatalf("counter %v: wanted %v, got %q", counter, want, code)
+		}
+	}
+}
+
+// RFC 6238, appendix B.
+func TestTOTPKnownAnswers(t *testing.T) {
+	for _, eg := range []struct {
+		unix                 int64
+		sha1, sha256, sha512 string
+	}{
+		{59, "94287082", "46119246", "90693936"},
+		{1111111109, "07081804", "68084774", "25091201"},
+		{1111111111, "14050471", "67062674", "99943326"},
+		{1234567890, "89005924", "91819424", "93441116"},
+		{2000000000, "69279037", "90698825", "38618901"},
+		{20000000000, "65353130", "77737706", "47863826"},
+	} {
+		timeString := time.Unix(eg.unix, 0).UTC().Format(time.RFC3339)
+		for _, alg := range []struct {
+			hash, secret, want string
+		}{
+			{"sha1", otpCodeSHA1Secret, eg.sha1},
+			{"sha256", otpCodeSHA256Secret, eg.sha256},
+			{"sha512", otpCodeSHA512Secret, eg.sha512},
+		} {
+			code, _, err := runRSACmd(t, []string{"totp", "--digits", "8", "--hash", alg.hash, "--time", timeString}, alg.secret)
+			if err != nil {
+				t.Fatalf("%v at %v: unexpected error: %v", alg.hash, timeString, err)
+			}
+			if code != alg.want+"\n" {
+				t.Fatalf("%v at %v: wanted %v, got %q", alg.hash, timeString, alg.want, code)
+			}
+		}
+	}
+}
+
+func TestOTPCodeSecretFormats(t *testing.T) {
+	// Lowercase, spaced and unpadded secrets, and otpauth URIs whose
+	// parameters flags override.
+	for _, eg := range []struct {
+		args  []string
+		input string
+		want  string
+	}{
+		{[]string{"hotp", "--counter", "1"}, "gezd gnbv gy3t qojq gezd gnbv gy3t qojq\n", "287082"},
+		{[]string{"hotp"}, "otpauth://hotp/ACME:alice?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&counter=1&issuer=ACME", "287082"},
+		{[]string{"totp", "--time", "1970-01-01T00:00:59Z"},
+			"otpauth://totp/ACME:alice?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&digits=8&algorithm=SHA1", "94287082"},
+		{[]string{"totp", "--time", "1970-01-01T00:00:59Z", "--digits", "6"},
+			"otpauth://totp/ACME:alice?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&digits=8", "287082"},
+		// With a 60-second period, the time step of 1111111111 with 30-second
+		// steps starts at twice the time.
+		{[]string{"totp", "--time", time.Unix(1111111111/30*60, 0).UTC().Format(time.RFC3339), "--digits", "8"},
+			"otpauth://totp/alice?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&period=60", "14050471"},
+	} {
+		code, _, err := runRSACmd(t, eg.args, eg.input)
+		if err != nil {
+			t.Fatalf("args=%#v input=%q: unexpected error: %v", eg.args, eg.input, err)
+		}
+		if code != eg.want+"\n" {
+			t.Fatalf("args=%#v input=%q: wanted %v, got %q", eg.args, eg.input, eg.want, code)
+		}
+	}
+}
+
+func TestTOTPVerify(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	// 94287082 is the code for time step 1 (30-59s).
+	for _, tc := range []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"--time", "1970-01-01T00:00:30Z"}, ""},
+		{[]string{"--time", "1970-01-01T00:01:00Z"}, ""},
+		{[]string{"--time", "1970-01-01T00:00:00Z"}, ""},
+		{[]string{"--time", "1970-01-01T00:01:30Z"}, "invalid code within 1 time step(s) of 1970-01-01T00:01:30Z"},
+		{[]string{"--time", "1970-01-01T00:01:30Z", "--skew", "2"}, ""},
+		{[]string{"--time", "1970-01-01T00:01:00Z", "--skew", "0"}, "invalid code within 0 time step(s)"},
+	} {
+		args := append([]string{"totp", "verify", "--digits", "8", "--code", "94287082"}, tc.args...)
+		_, _, err := runRSACmd(t, args, otpCodeSHA1Secret)
+		if tc.err == "" && err != nil {
+			t.Fatalf("args=%#v: unexpected error: %v", args, err)
+		}
+		if tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+			t.Fatalf("args=%#v: expected error containing %q, got %v", args, tc.err, err)
+		}
+	}
+	if !strings.Contains(buf.String(), "WARNING: code matched 1 time step(s) away") {
+		t.Fatalf("expected a clock skew warning, got %q", buf.String())
+	}
+}
+
+func TestHOTPVerify(t *testing.T) {
+	// 969429 is the code for counter 3.
+	next, _, err := runRSACmd(t, []string{"hotp", "verify", "--code", "969429", "--counter", "1", "--window", "2"}, otpCodeSHA1Secret)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if next != "4\n" {
+		t.Fatalf("wanted the next counter 4, got %q", next)
+	}
+	_, _, err = runRSACmd(t, []string{"hotp", "verify", "--code", "969429", "--counter", "1", "--window", "1"}, otpCodeSHA1Secret)
+	if err == nil || !strings.Contains(err.Error(), "invalid code for counters 1 to 2") {
+		t.Fatalf("expected an invalid code error, got %v", err)
+	}
+}
+
+func TestOTPCodeErrors(t *testing.T) {
+	for _, tc := range []struct {
+		args  []string
+		input string
+		err   string
+	}{
+		{[]string{"totp"}, "", "missing secret"},
+		{[]string{"totp"}, "not base32!", "invalid base32 secret"},
+		{[]string{"totp", "--digits", "5"}, otpCodeSHA1Secret, `invalid "--digits" value 5: must be in range [6,8]`},
+		{[]string{"totp", "--hash", "md5"}, otpCodeSHA1Secret, `invalid "--hash" flag "md5": must be one of sha1, sha256, sha512`},
+		{[]string{"totp", "--period", "0"}, otpCodeSHA1Secret, `invalid "--period" value 0: must be positive`},
+		{[]string{"totp", "--time", "yesterday"}, otpCodeSHA1Secret, `invalid "--time" value "yesterday"`},
+		{[]string{"totp"}, "otpauth://hotp/alice?secret=" + otpCodeSHA1Secret, `otpauth URI is for "hotp", not "totp"`},
+		{[]string{"totp"}, "otpauth://totp/alice?issuer=ACME", `otpauth URI has no "secret" parameter`},
+		{[]string{"totp"}, "otpauth://totp/alice?secret=" + otpCodeSHA1Secret + "&digits=six",
+			`invalid otpauth URI "digits" parameter "six"`},
+		{[]string{"totp", "verify"}, otpCodeSHA1Secret, `missing required "--code" flag`},
+		{[]string{"hotp", "verify", "--code", "123456", "--window", "-1"}, otpCodeSHA1Secret,
+			`invalid "--window" value -1: must not be negative`},
+	} {
+		_, _, err := runRSACmd(t, tc.args, tc.input)
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Fatalf("args=%#v: expected error containing %q, got %v", tc.args, tc.err, err)
+		}
+	}
+}